@@ -0,0 +1,282 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Auth configures how requests are authenticated. It can be set in an environment
+// (including profiles and groups) or on a request, which replaces the environment's auth.
+// Settings can use template tags, and passwords, tokens and keys are redacted from output.
+type Auth struct {
+	// OAuth2 fetches an access token and sends it in the Authorization header (see oauth2.go)
+	OAuth2 *OAuth2 `yaml:"oauth2"`
+	// Basic uses HTTP basic auth
+	Basic *Credentials `yaml:"basic"`
+	// Digest uses HTTP digest auth, answering the challenge from the server's 401 response
+	Digest *Credentials `yaml:"digest"`
+	// APIKey sends a key in a header or query parameter
+	APIKey *APIKey `yaml:"apiKey"`
+	// Bearer sends a token in the Authorization header
+	Bearer string `yaml:"bearer"`
+	// AWS signs requests with AWS Signature Version 4 (see sign.go)
+	AWS *AWSSigV4 `yaml:"aws"`
+	// HMAC signs requests with an HMAC signature (see sign.go)
+	HMAC *HMACSignature `yaml:"hmac"`
+}
+
+// Credentials are a username and password for basic or digest auth
+type Credentials struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// APIKey is a key sent in a header (the default) or query parameter.
+// Name defaults to X-API-Key.
+type APIKey struct {
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+	// In is header or query
+	In string `yaml:"in"`
+}
+
+// authError is returned when the credentials for a request can't be found, e.g. when
+// an OAuth2 token request fails. Auth errors are reported separately from assertion failures.
+type authError struct {
+	err error
+}
+
+func (e authError) Error() string {
+	return fmt.Sprintf("  AUTH FAIL, %v", e.err)
+}
+
+// applyAuth adds credentials to a request. Digest auth is added later, after the server's
+// challenge is received (see answerDigest). The transport is used for any requests needed
+// to get credentials (e.g. OAuth2 token requests).
+func applyAuth(req *http.Request, auth *Auth, vars map[string]interface{}, transport http.RoundTripper) error {
+	if auth == nil {
+		return nil
+	}
+
+	if auth.OAuth2 != nil {
+		token, err := auth.OAuth2.token(vars, transport)
+		if err != nil {
+			return authError{err}
+		}
+		req.Header.Set("Authorization", token.header())
+	}
+
+	if auth.Basic != nil {
+		c, err := auth.Basic.render(vars)
+		if err != nil {
+			return authError{err}
+		}
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	if auth.Bearer != "" {
+		token, err := renderSecret(auth.Bearer, vars)
+		if err != nil {
+			return authError{err}
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	if auth.APIKey != nil {
+		key, err := renderSecret(auth.APIKey.Value, vars)
+		if err != nil {
+			return authError{err}
+		}
+		name := auth.APIKey.Name
+		if name == "" {
+			name = "X-API-Key"
+		}
+		switch strings.ToLower(auth.APIKey.In) {
+		case "", "header":
+			req.Header.Set(name, key)
+		case "query":
+			q := req.URL.Query()
+			q.Set(name, key)
+			req.URL.RawQuery = q.Encode()
+		default:
+			return authError{fmt.Errorf("apiKey in must be header or query, not %s", auth.APIKey.In)}
+		}
+	}
+	return nil
+}
+
+// renderSecret replaces template tags in an auth value, and redacts the value from output.
+func renderSecret(text string, vars map[string]interface{}) (string, error) {
+	value, err := renderTemplate("auth", text, vars)
+	if err != nil {
+		return "", err
+	}
+	secrets.add(value)
+	return value, nil
+}
+
+func (c Credentials) render(vars map[string]interface{}) (Credentials, error) {
+	username, err := renderTemplate("auth", c.Username, vars)
+	if err != nil {
+		return c, err
+	}
+	password, err := renderSecret(c.Password, vars)
+	if err != nil {
+		return c, err
+	}
+	return Credentials{Username: username, Password: password}, nil
+}
+
+// answerDigest sends a request again with digest auth, in response to a 401 response
+// with a digest challenge (WWW-Authenticate: Digest ...). It returns the original
+// response if there was no digest challenge. The time the retry was sent is returned,
+// so that the response time measures the retry; it is zero if there was no retry.
+func answerDigest(client *http.Client, req *http.Request, resp *http.Response, auth *Auth, vars map[string]interface{}) (*http.Response, time.Time, error) {
+	if auth == nil || auth.Digest == nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, time.Time{}, nil
+	}
+	challenge := resp.Header.Get("WWW-Authenticate")
+	if !strings.HasPrefix(strings.ToLower(challenge), "digest ") {
+		return resp, time.Time{}, nil
+	}
+	resp.Body.Close()
+
+	c, err := auth.Digest.render(vars)
+	if err != nil {
+		return nil, time.Time{}, authError{err}
+	}
+	header, err := digestAuthorization(c, req.Method, req.URL.RequestURI(), parseAuthParams(challenge[len("digest "):]))
+	if err != nil {
+		return nil, time.Time{}, authError{err}
+	}
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, time.Time{}, err
+		}
+	}
+	retry.Header.Set("Authorization", header)
+	sent := time.Now()
+	resp, err = client.Do(retry)
+	return resp, sent, err
+}
+
+// digestAuthorization computes the Authorization header for a digest challenge (RFC 7616).
+// The MD5 and SHA-256 algorithms (and their -sess variants) and the "auth" qop are supported.
+func digestAuthorization(c Credentials, method string, uri string, challenge map[string]string) (string, error) {
+	algorithm := challenge["algorithm"]
+	var newHash func() hash.Hash
+	switch strings.ToUpper(strings.TrimSuffix(strings.ToLower(algorithm), "-sess")) {
+	case "", "MD5":
+		newHash = md5.New
+	case "SHA-256":
+		newHash = sha256.New
+	default:
+		return "", fmt.Errorf("unsupported digest algorithm %s", algorithm)
+	}
+	h := func(s string) string {
+		sum := newHash()
+		sum.Write([]byte(s))
+		return hex.EncodeToString(sum.Sum(nil))
+	}
+
+	realm, nonce := challenge["realm"], challenge["nonce"]
+	if nonce == "" {
+		return "", errors.New("digest challenge has no nonce")
+	}
+	cnonce, err := randomString(16)
+	if err != nil {
+		return "", err
+	}
+	nc := "00000001"
+
+	ha1 := h(c.Username + ":" + realm + ":" + c.Password)
+	if strings.HasSuffix(strings.ToLower(algorithm), "-sess") {
+		ha1 = h(ha1 + ":" + nonce + ":" + cnonce)
+	}
+	ha2 := h(method + ":" + uri)
+
+	qop := ""
+	for _, q := range strings.Split(challenge["qop"], ",") {
+		if strings.TrimSpace(q) == "auth" {
+			qop = "auth"
+		}
+	}
+	if challenge["qop"] != "" && qop == "" {
+		return "", fmt.Errorf("unsupported digest qop %s", challenge["qop"])
+	}
+
+	var response string
+	if qop == "" {
+		response = h(ha1 + ":" + nonce + ":" + ha2)
+	} else {
+		response = h(strings.Join([]string{ha1, nonce, nc, cnonce, qop, ha2}, ":"))
+	}
+
+	params := []string{
+		fmt.Sprintf(`username="%s"`, c.Username),
+		fmt.Sprintf(`realm="%s"`, realm),
+		fmt.Sprintf(`nonce="%s"`, nonce),
+		fmt.Sprintf(`uri="%s"`, uri),
+		fmt.Sprintf(`response="%s"`, response),
+	}
+	if algorithm != "" {
+		params = append(params, "algorithm="+algorithm)
+	}
+	if qop != "" {
+		params = append(params, "qop="+qop, "nc="+nc, fmt.Sprintf(`cnonce="%s"`, cnonce))
+	}
+	if opaque, ok := challenge["opaque"]; ok {
+		params = append(params, fmt.Sprintf(`opaque="%s"`, opaque))
+	}
+	return "Digest " + strings.Join(params, ", "), nil
+}
+
+// parseAuthParams parses the parameters of a WWW-Authenticate header,
+// e.g. realm="example", qop="auth,auth-int", nonce="abc"
+func parseAuthParams(s string) map[string]string {
+	params := make(map[string]string)
+	for s != "" {
+		s = strings.TrimLeft(s, " ,")
+		eq := strings.Index(s, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = strings.TrimLeft(s[eq+1:], " ")
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			var buf strings.Builder
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				buf.WriteByte(s[i])
+			}
+			value = buf.String()
+			if i < len(s) {
+				i++
+			}
+			s = s[i:]
+		} else {
+			end := strings.Index(s, ",")
+			if end < 0 {
+				end = len(s)
+			}
+			value = strings.TrimSpace(s[:end])
+			s = s[end:]
+		}
+		params[key] = value
+	}
+	return params
+}
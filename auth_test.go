@@ -0,0 +1,137 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApplyAuth(t *testing.T) {
+	resetSecrets()
+	defer resetSecrets()
+
+	vars := map[string]interface{}{"user": "alice", "password": "pw-123", "token": "tok-456", "key": "key-789"}
+
+	cases := []struct {
+		auth     Auth
+		header   string
+		expected string
+		query    string
+	}{
+		{Auth{Basic: &Credentials{Username: "{{user}}", Password: "{{password}}"}}, "Authorization", "Basic YWxpY2U6cHctMTIz", ""},
+		{Auth{Bearer: "{{token}}"}, "Authorization", "Bearer tok-456", ""},
+		{Auth{APIKey: &APIKey{Value: "{{key}}"}}, "X-API-Key", "key-789", ""},
+		{Auth{APIKey: &APIKey{Name: "Api-Token", Value: "{{key}}", In: "header"}}, "Api-Token", "key-789", ""},
+		{Auth{APIKey: &APIKey{Name: "api_key", Value: "{{key}}", In: "query"}}, "", "", "api_key=key-789&page=1"},
+	}
+
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", "http://example.com/todos?page=1", nil)
+		if err := applyAuth(req, &c.auth, vars, http.DefaultTransport); err != nil {
+			t.Errorf("%+v: %v", c.auth, err)
+			continue
+		}
+		if c.header != "" && req.Header.Get(c.header) != c.expected {
+			t.Errorf("expected %s: %s, received %s", c.header, c.expected, req.Header.Get(c.header))
+		}
+		if c.query != "" && req.URL.RawQuery != c.query {
+			t.Errorf("expected query %s, received %s", c.query, req.URL.RawQuery)
+		}
+	}
+
+	// passwords, tokens and keys are redacted from output
+	for _, v := range []string{"pw-123", "tok-456", "key-789"} {
+		if secrets.redact(v) != redactedValue {
+			t.Errorf("expected %s to be redacted", v)
+		}
+	}
+}
+
+func TestDigestAuth(t *testing.T) {
+	resetSecrets()
+	defer resetSecrets()
+
+	const realm, nonce, opaque = "test realm", "abc123", "xyz"
+	h := func(s string) string {
+		sum := md5.Sum([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		header := req.Header.Get("Authorization")
+		if !strings.HasPrefix(header, "Digest ") {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Digest realm="%s", qop="auth,auth-int", nonce="%s", opaque="%s", algorithm=MD5`, realm, nonce, opaque))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		p := parseAuthParams(header[len("Digest "):])
+		ha1 := h("alice:" + realm + ":digest-pw")
+		ha2 := h(req.Method + ":" + req.URL.RequestURI())
+		expected := h(strings.Join([]string{ha1, nonce, p["nc"], p["cnonce"], p["qop"], ha2}, ":"))
+		if p["response"] != expected || p["opaque"] != opaque || p["uri"] != req.URL.RequestURI() {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	env := Environment{Vars: map[string]interface{}{"host": server.URL, "password": "digest-pw"}}
+	r := Request{
+		Name:   "Digest",
+		URL:    "{{host}}/private?x=1",
+		Method: "post",
+		Body:   map[string]interface{}{"a": 1},
+		Auth:   &Auth{Digest: &Credentials{Username: "alice", Password: "{{password}}"}},
+		Expect: Expect{Status: StatusExpectation{Codes: []int{200}}},
+	}
+	if _, _, err := request(r, 1, env, RunOptions{}); err != nil {
+		t.Error(err)
+	}
+
+	// without digest auth, the 401 response is checked as usual
+	r.Auth = nil
+	if _, _, err := request(r, 1, env, RunOptions{}); err == nil {
+		t.Error("expected the request to fail without auth")
+	}
+}
+
+func TestUnauthorizedDuration(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	// a 401 response without a digest retry is timed like any other response
+	env := Environment{Vars: map[string]interface{}{"host": server.URL}}
+	r := Request{
+		Name:   "slow 401",
+		URL:    "{{host}}/private",
+		Method: "get",
+		Expect: Expect{Status: StatusExpectation{Codes: []int{401}}, MaxDuration: Duration{10 * time.Millisecond}},
+	}
+	_, duration, err := request(r, 1, env, RunOptions{})
+	if err == nil {
+		t.Error("expected request exceeding maxDuration to fail")
+	}
+	if duration < 50*time.Millisecond {
+		t.Errorf("expected a duration of at least 50ms, received %v", duration)
+	}
+}
+
+func TestParseAuthParams(t *testing.T) {
+	p := parseAuthParams(`realm="a \"quoted\", realm", qop="auth,auth-int", stale=FALSE, nonce="n"`)
+	expected := map[string]string{"realm": `a "quoted", realm`, "qop": "auth,auth-int", "stale": "FALSE", "nonce": "n"}
+	for k, v := range expected {
+		if p[k] != v {
+			t.Errorf("%s: expected %s, received %s", k, v, p[k])
+		}
+	}
+}
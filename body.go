@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// BodyExpectation compares the whole response body against an expected document.
+// The expected document can be provided inline (Value) or read from a fixture
+// file (File) containing JSON or YAML.
+// Ignore is a list of selectors (e.g. `id` or `items.[*].created_at`) that will not
+// be compared. IgnoreOrder compares arrays without regard to the order of their items,
+// and Subset allows the response to contain keys (and trailing array items) that are
+// not in the expected document.
+type BodyExpectation struct {
+	Value       interface{} `yaml:"value"`
+	File        string      `yaml:"file"`
+	Ignore      []string    `yaml:"ignore"`
+	IgnoreOrder bool        `yaml:"ignoreOrder"`
+	Subset      bool        `yaml:"subset"`
+}
+
+// bodyDiff is a single difference found between an expected and a received body.
+type bodyDiff struct {
+	Path     string
+	Kind     string // "changed", "missing" or "unexpected"
+	Expected interface{}
+	Received interface{}
+}
+
+// bodyComparer walks an expected document and a received document and
+// collects the differences between them.
+type bodyComparer struct {
+	ignore      [][]string
+	ignoreOrder bool
+	subset      bool
+	diffs       []bodyDiff
+}
+
+// checkBody compares a decoded JSON response body against the expected document,
+// returning an error describing every difference found.
+func checkBody(received interface{}, expectation BodyExpectation) error {
+	expected, err := expectation.document()
+	if err != nil {
+		return err
+	}
+
+	diffs := compareBodies(expected, received, expectation)
+	if len(diffs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("body differs from expected (%v differences):\n%s", len(diffs), formatBodyDiffs(diffs))
+}
+
+// document returns the expected body, reading it from the fixture file if one
+// was provided. The document is normalized so that its values have the same types
+// as a decoded JSON response (e.g. all numbers are float64).
+func (b BodyExpectation) document() (interface{}, error) {
+	doc := b.Value
+
+	if b.File != "" {
+		file, err := ioutil.ReadFile(b.File)
+		if err != nil {
+			return nil, fmt.Errorf("could not read expected body file: %v", err)
+		}
+		// YAML is a superset of JSON, so fixtures can be written in either format.
+		if err := yaml.Unmarshal(file, &doc); err != nil {
+			return nil, fmt.Errorf("could not decode expected body file %s: %v", b.File, err)
+		}
+	}
+
+	return normalizeJSON(doc)
+}
+
+// normalizeJSON converts a value (e.g. decoded from YAML) into the types that
+// would be produced by decoding the same value from JSON.
+func normalizeJSON(value interface{}) (interface{}, error) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("could not convert expected body to JSON: %v", err)
+	}
+	var normalized interface{}
+	if err := json.Unmarshal(b, &normalized); err != nil {
+		return nil, fmt.Errorf("could not convert expected body to JSON: %v", err)
+	}
+	return normalized, nil
+}
+
+// compareBodies returns the list of differences between the expected and received
+// documents, taking into account the options set on the body expectation.
+func compareBodies(expected interface{}, received interface{}, options BodyExpectation) []bodyDiff {
+	c := &bodyComparer{
+		ignoreOrder: options.IgnoreOrder,
+		subset:      options.Subset,
+	}
+	for _, selector := range options.Ignore {
+		c.ignore = append(c.ignore, selectorSegments(selector))
+	}
+	c.compare([]string{}, expected, received)
+	return c.diffs
+}
+
+func (c *bodyComparer) compare(path []string, expected interface{}, received interface{}) {
+	if c.ignored(path) {
+		return
+	}
+
+	switch e := expected.(type) {
+	case map[string]interface{}:
+		r, ok := received.(map[string]interface{})
+		if !ok {
+			c.add(path, "changed", expected, received)
+			return
+		}
+
+		for _, k := range sortedKeys(e) {
+			value, ok := r[k]
+			if !ok {
+				if !c.ignored(appendPath(path, k)) {
+					c.add(appendPath(path, k), "missing", e[k], nil)
+				}
+				continue
+			}
+			c.compare(appendPath(path, k), e[k], value)
+		}
+
+		if c.subset {
+			return
+		}
+		for _, k := range sortedKeys(r) {
+			if _, ok := e[k]; !ok && !c.ignored(appendPath(path, k)) {
+				c.add(appendPath(path, k), "unexpected", nil, r[k])
+			}
+		}
+	case []interface{}:
+		r, ok := received.([]interface{})
+		if !ok {
+			c.add(path, "changed", expected, received)
+			return
+		}
+
+		if c.ignoreOrder {
+			c.compareUnordered(path, e, r)
+			return
+		}
+
+		for i := range e {
+			if i >= len(r) {
+				c.add(appendPath(path, index(i)), "missing", e[i], nil)
+				continue
+			}
+			c.compare(appendPath(path, index(i)), e[i], r[i])
+		}
+
+		if c.subset {
+			return
+		}
+		for i := len(e); i < len(r); i++ {
+			c.add(appendPath(path, index(i)), "unexpected", nil, r[i])
+		}
+	default:
+		if !reflect.DeepEqual(expected, received) {
+			c.add(path, "changed", expected, received)
+		}
+	}
+}
+
+// compareUnordered matches each expected array item with an equal item anywhere in the
+// received array. Items that could not be matched are reported as missing or unexpected.
+func (c *bodyComparer) compareUnordered(path []string, expected []interface{}, received []interface{}) {
+	used := make([]bool, len(received))
+
+	for i, item := range expected {
+		matched := false
+		for j := range received {
+			if used[j] {
+				continue
+			}
+			sub := &bodyComparer{ignore: c.ignore, ignoreOrder: c.ignoreOrder, subset: c.subset}
+			sub.compare(appendPath(path, index(i)), item, received[j])
+			if len(sub.diffs) == 0 {
+				used[j] = true
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			c.add(appendPath(path, index(i)), "missing", item, nil)
+		}
+	}
+
+	if c.subset {
+		return
+	}
+	for j := range received {
+		if !used[j] {
+			c.add(appendPath(path, index(j)), "unexpected", nil, received[j])
+		}
+	}
+}
+
+func (c *bodyComparer) add(path []string, kind string, expected interface{}, received interface{}) {
+	c.diffs = append(c.diffs, bodyDiff{
+		Path:     formatPath(path),
+		Kind:     kind,
+		Expected: expected,
+		Received: received,
+	})
+}
+
+// ignored returns true if the path matches one of the ignore selectors.
+// `*` matches any key and `[*]` matches any array index.
+func (c *bodyComparer) ignored(path []string) bool {
+	for _, pattern := range c.ignore {
+		if len(pattern) != len(path) {
+			continue
+		}
+		match := true
+		for i, segment := range pattern {
+			if segment == path[i] {
+				continue
+			}
+			if segment == "*" && !strings.HasPrefix(path[i], "[") {
+				continue
+			}
+			if segment == "[*]" && strings.HasPrefix(path[i], "[") {
+				continue
+			}
+			match = false
+			break
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// formatBodyDiffs returns a line for each difference, using the same jq style
+// selectors as expect.values (e.g. `.items.[0].id`)
+func formatBodyDiffs(diffs []bodyDiff) string {
+	lines := []string{}
+	for _, d := range diffs {
+		switch d.Kind {
+		case "missing":
+			lines = append(lines, fmt.Sprintf("    %s %s missing, expected: %s", colorize(colorRed, "-"), d.Path, colorize(colorRed, formatValue(d.Expected))))
+		case "unexpected":
+			lines = append(lines, fmt.Sprintf("    %s %s unexpected, received: %s", colorize(colorGreen, "+"), d.Path, colorize(colorGreen, formatValue(d.Received))))
+		default:
+			lines = append(lines, fmt.Sprintf("    %s %s expected: %s received: %s", colorize(colorYellow, "~"), d.Path, colorize(colorRed, formatValue(d.Expected)), colorize(colorGreen, formatValue(d.Received))))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatValue returns a compact JSON representation of a value for output.
+func formatValue(value interface{}) string {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(b)
+}
+
+// selectorSegments splits a jq style selector (e.g. `.foo.[0].bar` or `foo.bar`) into segments.
+func selectorSegments(selector string) []string {
+	segments := []string{}
+	for _, s := range strings.Split(selector, ".") {
+		s = strings.TrimSpace(s)
+		if s != "" {
+			segments = append(segments, s)
+		}
+	}
+	return segments
+}
+
+func formatPath(path []string) string {
+	return "." + strings.Join(path, ".")
+}
+
+// appendPath returns a new path with the segment added, leaving the original path unmodified.
+func appendPath(path []string, segment string) []string {
+	p := make([]string, len(path), len(path)+1)
+	copy(p, path)
+	return append(p, segment)
+}
+
+func index(i int) string {
+	return "[" + strconv.Itoa(i) + "]"
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
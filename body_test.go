@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCompareBodies(t *testing.T) {
+	type testCase struct {
+		Name     string
+		Expected string
+		Received string
+		Options  BodyExpectation
+		Diffs    int
+	}
+
+	cases := []testCase{
+		testCase{Name: "equal", Expected: `{"id":1,"tags":["a","b"]}`, Received: `{"id":1,"tags":["a","b"]}`, Diffs: 0},
+		testCase{Name: "changed value", Expected: `{"id":1,"title":"foo"}`, Received: `{"id":1,"title":"bar"}`, Diffs: 1},
+		testCase{Name: "missing and unexpected keys", Expected: `{"id":1,"title":"foo"}`, Received: `{"id":1,"name":"foo"}`, Diffs: 2},
+		testCase{Name: "type change", Expected: `{"id":1}`, Received: `{"id":"1"}`, Diffs: 1},
+		testCase{Name: "array order", Expected: `["a","b"]`, Received: `["b","a"]`, Diffs: 2},
+		testCase{Name: "ignore array order", Expected: `["a","b"]`, Received: `["b","a"]`, Options: BodyExpectation{IgnoreOrder: true}, Diffs: 0},
+		testCase{Name: "ignore order with missing item", Expected: `["a","c"]`, Received: `["b","a"]`, Options: BodyExpectation{IgnoreOrder: true}, Diffs: 2},
+		testCase{Name: "subset", Expected: `{"id":1}`, Received: `{"id":1,"title":"foo"}`, Options: BodyExpectation{Subset: true}, Diffs: 0},
+		testCase{Name: "subset with missing key", Expected: `{"id":1,"title":"foo"}`, Received: `{"id":1}`, Options: BodyExpectation{Subset: true}, Diffs: 1},
+		testCase{Name: "ignore paths", Expected: `{"id":1,"created":"x"}`, Received: `{"id":2,"created":"y"}`, Options: BodyExpectation{Ignore: []string{"id", ".created"}}, Diffs: 0},
+		testCase{Name: "ignore array item paths", Expected: `{"items":[{"id":1,"n":"a"},{"id":2,"n":"b"}]}`, Received: `{"items":[{"id":5,"n":"a"},{"id":6,"n":"b"}]}`, Options: BodyExpectation{Ignore: []string{"items.[*].id"}}, Diffs: 0},
+		testCase{Name: "ignore missing key", Expected: `{"id":1,"created":"x"}`, Received: `{"id":1}`, Options: BodyExpectation{Ignore: []string{"created"}}, Diffs: 0},
+	}
+
+	for _, c := range cases {
+		var expected, received interface{}
+		if err := json.Unmarshal([]byte(c.Expected), &expected); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal([]byte(c.Received), &received); err != nil {
+			t.Fatal(err)
+		}
+
+		diffs := compareBodies(expected, received, c.Options)
+		if len(diffs) != c.Diffs {
+			t.Errorf("%s: expected %v differences, received %v: %s", c.Name, c.Diffs, len(diffs), formatBodyDiffs(diffs))
+		}
+	}
+}
+
+func TestCheckBodyFile(t *testing.T) {
+	var received interface{}
+	json.Unmarshal([]byte(`{"id":1,"title":"delectus aut autem","description":"something to do","num_tasks":2}`), &received)
+
+	if err := checkBody(received, BodyExpectation{File: "test/todo.json"}); err != nil {
+		t.Error(err)
+	}
+
+	// inline values decoded from YAML have int types and must still match JSON numbers
+	inline := BodyExpectation{Value: map[string]interface{}{"id": 1, "num_tasks": 2}, Subset: true}
+	if err := checkBody(received, inline); err != nil {
+		t.Error(err)
+	}
+
+	inline.Value = map[string]interface{}{"id": 2}
+	if err := checkBody(received, inline); err == nil {
+		t.Error("expected body with a different id to fail")
+	}
+}
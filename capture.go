@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/savaki/jq"
+)
+
+// setUserVars sets variables (defined by a `set:` block in the request spec) from the response.
+func setUserVars(setVars []UserVar, resp *http.Response, body []byte, duration time.Duration, vars map[string]interface{}) error {
+	for _, v := range setVars {
+		value, err := captureVar(v, resp, body, duration)
+		if err != nil {
+			if v.Default == nil {
+				return err
+			}
+			value = v.Default
+		}
+		vars[v.Name] = value
+		if v.Secret {
+			secrets.add(templateString(value))
+		}
+	}
+	return nil
+}
+
+// captureVar finds the value for a variable from one of the response's sources:
+// a JSON body selector (from), a header, a cookie, the status code, or the duration
+// in milliseconds. If a regex is provided, it is matched against the source value
+// (or the raw body if no other source was given) and the first capture group is used.
+func captureVar(v UserVar, resp *http.Response, body []byte, duration time.Duration) (interface{}, error) {
+	var value interface{}
+
+	switch {
+	case v.Header != "":
+		values, ok := resp.Header[http.CanonicalHeaderKey(v.Header)]
+		if !ok || len(values) == 0 {
+			return nil, fmt.Errorf("error setting variable %s: header %s not found in response", v.Name, v.Header)
+		}
+		value = values[0]
+	case v.Cookie != "":
+		found := false
+		for _, c := range resp.Cookies() {
+			if c.Name == v.Cookie {
+				value = c.Value
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("error setting variable %s: cookie %s not found in response", v.Name, v.Cookie)
+		}
+	case v.Status:
+		value = resp.StatusCode
+	case v.Duration:
+		value = int64(duration / time.Millisecond)
+	case v.Key != "":
+		selector := v.Key
+		if c := fmt.Sprintf("%c", selector[0]); c != "." {
+			selector = "." + selector
+		}
+
+		op, err := jq.Parse(selector)
+		if err != nil {
+			return nil, fmt.Errorf("error setting variable from selector %s. Use jq format: e.g. foo or .foo.bar or foo.bar (all valid)", selector)
+		}
+
+		result, err := op.Apply(body)
+		if err != nil {
+			return nil, fmt.Errorf("error finding value for key %s to use as variable. Key may not exist. Hint: Use jq format: e.g. foo or .foo.bar or foo.bar (all valid)", selector)
+		}
+
+		json.Unmarshal(result, &value)
+	case v.Regex != "":
+		value = string(body)
+	default:
+		return nil, fmt.Errorf("error setting variable %s: no source provided. Use from, header, cookie, status, duration or regex", v.Name)
+	}
+
+	if v.Regex == "" {
+		return value, nil
+	}
+
+	re, err := regexp.Compile(v.Regex)
+	if err != nil {
+		return nil, fmt.Errorf("error setting variable %s: invalid regex %s: %v", v.Name, v.Regex, err)
+	}
+	match := re.FindStringSubmatch(templateString(value))
+	if match == nil {
+		return nil, fmt.Errorf("error setting variable %s: regex %s did not match %s", v.Name, v.Regex, strings.TrimSpace(templateString(value)))
+	}
+	if len(match) > 1 {
+		return match[1], nil
+	}
+	return match[0], nil
+}
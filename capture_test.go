@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSetUserVars(t *testing.T) {
+	resp := &http.Response{StatusCode: 201, Header: http.Header{}}
+	resp.Header.Set("Location", "/api/orders/42")
+	resp.Header.Add("Set-Cookie", "session=abc123; Path=/")
+	body := []byte(`{"id": 42, "user": {"name": "alice"}}`)
+
+	setVars := []UserVar{
+		UserVar{Name: "id", Key: "id"},
+		UserVar{Name: "user_name", Key: ".user.name"},
+		UserVar{Name: "location", Header: "location"},
+		UserVar{Name: "order_id", Header: "Location", Regex: `/orders/(\d+)$`},
+		UserVar{Name: "session", Cookie: "session"},
+		UserVar{Name: "status", Status: true},
+		UserVar{Name: "duration", Duration: true},
+		UserVar{Name: "body_id", Regex: `"id": (\d+)`},
+		UserVar{Name: "etag", Header: "ETag", Default: "none"},
+	}
+
+	vars := make(map[string]interface{})
+	if err := setUserVars(setVars, resp, body, 150*time.Millisecond, vars); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"id":        float64(42),
+		"user_name": "alice",
+		"location":  "/api/orders/42",
+		"order_id":  "42",
+		"session":   "abc123",
+		"status":    201,
+		"duration":  int64(150),
+		"body_id":   "42",
+		"etag":      "none",
+	}
+
+	for k, v := range expected {
+		if vars[k] != v {
+			t.Errorf("%s: expected '%v' (%T), received '%v' (%T)", k, v, v, vars[k], vars[k])
+		}
+	}
+
+	missing := [][]UserVar{
+		[]UserVar{UserVar{Name: "etag", Header: "ETag"}},
+		[]UserVar{UserVar{Name: "token", Cookie: "token"}},
+		[]UserVar{UserVar{Name: "order_id", Header: "Location", Regex: `/users/(\d+)$`}},
+		[]UserVar{UserVar{Name: "nothing"}},
+	}
+	for _, m := range missing {
+		if err := setUserVars(m, resp, body, 0, vars); err == nil {
+			t.Errorf("%s: expected an error for a missing value", m[0].Name)
+		}
+	}
+}
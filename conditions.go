@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Skip marks a request to be skipped. It can be `skip: true` or a reason
+// (`skip: waiting on bug fix`).
+type Skip struct {
+	Skip   bool
+	Reason string
+}
+
+// UnmarshalYAML accepts a boolean or a reason string.
+func (s *Skip) UnmarshalYAML(value *yaml.Node) error {
+	if b, err := strconv.ParseBool(value.Value); err == nil && value.Tag == "!!bool" {
+		s.Skip = b
+		return nil
+	}
+	s.Skip = true
+	s.Reason = value.Value
+	return nil
+}
+
+// comparisonOperators are checked in order, so that ">=" is found before ">"
+var comparisonOperators = []string{"==", "!=", ">=", "<=", ">", "<"}
+
+// skipReason returns true and a reason if the request should be skipped, either because
+// it is marked with `skip`, or because its `when` condition is false.
+func (r Request) skipReason(vars map[string]interface{}) (bool, string, error) {
+	if r.Skip.Skip {
+		if r.Skip.Reason != "" {
+			return true, r.Skip.Reason, nil
+		}
+		return true, "skip: true", nil
+	}
+
+	if r.When == "" {
+		return false, "", nil
+	}
+	ok, err := evalCondition(r.When, vars)
+	if err != nil {
+		return false, "", fmt.Errorf("error in when condition %s: %v", r.When, err)
+	}
+	if !ok {
+		return true, fmt.Sprintf("condition is false: %s", r.When), nil
+	}
+	return false, "", nil
+}
+
+// evalCondition evaluates a condition. A condition is a comparison (==, !=, >, <, >=, <=) or a
+// single value, which is true unless it is empty, "false", "0", "null" or "nil". Comparisons can be
+// combined with && and || (&& is evaluated first). Values are compared as numbers when both sides are numbers.
+//
+// The condition is split into operands before template tags are rendered, so operators inside
+// variable values or quoted strings (e.g. a token ending in "==") are not part of the expression.
+func evalCondition(condition string, vars map[string]interface{}) (bool, error) {
+	for _, or := range splitCondition(condition, "||") {
+		all := true
+		for _, and := range splitCondition(or, "&&") {
+			ok, err := evalComparison(and, vars)
+			if err != nil {
+				return false, err
+			}
+			if !ok {
+				all = false
+				break
+			}
+		}
+		if all {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func evalComparison(expr string, vars map[string]interface{}) (bool, error) {
+	for _, op := range comparisonOperators {
+		i := conditionIndex(expr, op)
+		if i < 0 {
+			continue
+		}
+		left, err := conditionOperand(expr[:i], vars)
+		if err != nil {
+			return false, err
+		}
+		right, err := conditionOperand(expr[i+len(op):], vars)
+		if err != nil {
+			return false, err
+		}
+
+		l, lerr := strconv.ParseFloat(left, 64)
+		r, rerr := strconv.ParseFloat(right, 64)
+		numeric := lerr == nil && rerr == nil
+
+		switch op {
+		case "==":
+			if numeric {
+				return l == r, nil
+			}
+			return left == right, nil
+		case "!=":
+			if numeric {
+				return l != r, nil
+			}
+			return left != right, nil
+		}
+
+		if !numeric {
+			return false, fmt.Errorf("%s can only compare numbers: %s", op, strings.TrimSpace(expr))
+		}
+		switch op {
+		case ">=":
+			return l >= r, nil
+		case "<=":
+			return l <= r, nil
+		case ">":
+			return l > r, nil
+		default:
+			return l < r, nil
+		}
+	}
+
+	value, err := conditionOperand(expr, vars)
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "false", "0", "null", "nil":
+		return false, nil
+	}
+	return true, nil
+}
+
+// conditionOperand trims spaces and quotes from one side of a comparison and renders its template tags.
+func conditionOperand(s string, vars map[string]interface{}) (string, error) {
+	s = strings.TrimSpace(s)
+	if len(s) > 1 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		s = s[1 : len(s)-1]
+	}
+	return renderTemplate("when", s, vars)
+}
+
+// splitCondition splits a condition on a separator, ignoring separators inside
+// template tags and quoted strings.
+func splitCondition(condition string, sep string) []string {
+	parts := []string{}
+	for {
+		i := conditionIndex(condition, sep)
+		if i < 0 {
+			return append(parts, condition)
+		}
+		parts = append(parts, condition[:i])
+		condition = condition[i+len(sep):]
+	}
+}
+
+// conditionIndex returns the index of the first s in a condition that is not inside a
+// template tag or a quoted string, or -1 if there is none.
+func conditionIndex(condition string, s string) int {
+	var quote byte
+	for i := 0; i < len(condition); i++ {
+		c := condition[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case strings.HasPrefix(condition[i:], `\{{`):
+			i += 2
+		case strings.HasPrefix(condition[i:], "{{"):
+			end := findTagEnd(condition[i:])
+			if end < 0 {
+				// the unclosed tag is reported when the operand is rendered
+				return -1
+			}
+			i += end + 1
+		case c == '"' || c == '\'':
+			quote = c
+		case strings.HasPrefix(condition[i:], s):
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestEvalCondition(t *testing.T) {
+	vars := map[string]interface{}{
+		"feature": true,
+		"version": 3,
+		"name":    "alice",
+		"empty":   "",
+		"token":   "dG9rZW4=",
+		"padded":  "YQ==",
+		"text":    "a && b || c",
+	}
+
+	cases := []struct {
+		condition string
+		expected  bool
+	}{
+		{"{{feature}}", true},
+		{"{{feature}} == true", true},
+		{"{{feature}} != true", false},
+		{"{{empty}}", false},
+		{"{{missing}}", false},
+		{"{{version}} > 2", true},
+		{"{{version}} >= 3", true},
+		{"{{version}} < 3", false},
+		{"{{version}} == 3.0", true},
+		{"{{name}} == 'alice'", true},
+		{`{{name}} == "bob"`, false},
+		{"{{version}} > 5 || {{name}} == alice", true},
+		{"{{version}} > 2 && {{name}} == bob", false},
+		{"{{version}} > 5 || {{feature}} && {{name}} == alice", true},
+		// operators in values and quoted strings are not part of the expression
+		{"{{padded}}", true},
+		{"{{token}} == dG9rZW4=", true},
+		{"{{padded}} != 'YQ=='", false},
+		{"{{text}}", true},
+		{"{{text}} == 'a && b || c'", true},
+		{"{{name}} == 'x || alice'", false},
+		{`{{ name | default "a == b" }} == alice`, true},
+	}
+
+	for _, c := range cases {
+		result, err := evalCondition(c.condition, vars)
+		if err != nil {
+			t.Errorf("%s: %v", c.condition, err)
+			continue
+		}
+		if result != c.expected {
+			t.Errorf("%s: expected %v, received %v", c.condition, c.expected, result)
+		}
+	}
+
+	if _, err := evalCondition("{{name}} > 2", vars); err == nil {
+		t.Error("expected an error comparing a string with >")
+	}
+}
+
+func TestSkipYAML(t *testing.T) {
+	r := Request{}
+	if err := yaml.Unmarshal([]byte("skip: true"), &r); err != nil {
+		t.Fatal(err)
+	}
+	if skip, reason, _ := r.skipReason(nil); !skip || reason != "skip: true" {
+		t.Errorf("expected request to be skipped, received %v %s", skip, reason)
+	}
+
+	r = Request{}
+	if err := yaml.Unmarshal([]byte("skip: flaky upstream"), &r); err != nil {
+		t.Fatal(err)
+	}
+	if skip, reason, _ := r.skipReason(nil); !skip || reason != "flaky upstream" {
+		t.Errorf("expected request to be skipped, received %v %s", skip, reason)
+	}
+
+	r = Request{}
+	if err := yaml.Unmarshal([]byte("skip: false"), &r); err != nil {
+		t.Fatal(err)
+	}
+	if skip, _, _ := r.skipReason(nil); skip {
+		t.Error("expected request not to be skipped")
+	}
+}
+
+func TestSkipOnlyWhen(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(basicRequestHandler))
+	defer server.Close()
+
+	env := Environment{Vars: map[string]interface{}{"host": server.URL, "enabled": false}}
+	expect := Expect{Status: StatusExpectation{Codes: []int{200}}}
+	requests := []Request{
+		{Name: "a", URL: "{{host}}/todos/1", Method: "get", Expect: expect},
+		{Name: "b", URL: "{{host}}/todos/1", Method: "get", Expect: expect, Skip: Skip{Skip: true}},
+		{Name: "c", URL: "{{host}}/todos/1", Method: "get", Expect: expect, When: "{{enabled}}"},
+		{Name: "d", URL: "{{host}}/todos/1", Method: "get", Expect: expect, When: "{{enabled}} == false"},
+	}
+
+	summary := runRequests(requests, env, RunOptions{})
+	if summary.Total != 2 || summary.Failed != 0 || summary.Skipped != 2 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+	if summary.String() != "(2 requests, 2 skipped)" {
+		t.Errorf("unexpected summary %s", summary)
+	}
+
+	// only requests marked with `only` are run
+	requests[0].Only = true
+	summary = runRequests(requests, env, RunOptions{})
+	if summary.Total != 1 || summary.Skipped != 0 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+}
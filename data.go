@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DataSource holds rows of variables for data-driven tests. A request with data
+// is run once per row, with the row's values available as template variables.
+// Rows can be listed inline, or read from a CSV file (with a header row) or a JSON
+// file (a list of objects). A row's `_label` value is added to the test name.
+type DataSource struct {
+	Rows []map[string]interface{}
+	File string
+}
+
+// UnmarshalYAML accepts a list of rows, a file name, or a block with a `file` key.
+func (d *DataSource) UnmarshalYAML(value *yaml.Node) error {
+	switch value.Kind {
+	case yaml.SequenceNode:
+		return value.Decode(&d.Rows)
+	case yaml.ScalarNode:
+		d.File = value.Value
+		return nil
+	default:
+		var source struct {
+			File string `yaml:"file"`
+		}
+		if err := value.Decode(&source); err != nil {
+			return err
+		}
+		d.File = source.File
+		return nil
+	}
+}
+
+// rows returns the data rows, reading them from the data file if there is one.
+func (d DataSource) rows() ([]map[string]interface{}, error) {
+	if d.File == "" {
+		return d.Rows, nil
+	}
+	if strings.ToLower(filepath.Ext(d.File)) == ".csv" {
+		return readCSVRows(d.File)
+	}
+
+	file, err := ioutil.ReadFile(d.File)
+	if err != nil {
+		return nil, fmt.Errorf("could not read data file: %v", err)
+	}
+	rows := []map[string]interface{}{}
+	if err := json.Unmarshal(file, &rows); err != nil {
+		return nil, fmt.Errorf("could not decode data file %s: %v. Use a CSV file or a JSON list of objects", d.File, err)
+	}
+	return rows, nil
+}
+
+// readCSVRows reads a CSV file, using the first row as variable names.
+// Numbers and booleans are converted so they keep their type when used in a request body.
+func readCSVRows(filename string) ([]map[string]interface{}, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("could not read data file: %v", err)
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("could not decode data file %s: %v", filename, err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("data file %s is empty", filename)
+	}
+
+	header := records[0]
+	rows := []map[string]interface{}{}
+	for _, record := range records[1:] {
+		row := make(map[string]interface{}, len(header))
+		for i, name := range header {
+			if i < len(record) {
+				row[strings.TrimSpace(name)] = csvValue(record[i])
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// csvValue converts a CSV cell to a number or boolean if it is written exactly
+// like one (so that values like "007" stay strings).
+func csvValue(cell string) interface{} {
+	if n, err := strconv.ParseInt(cell, 10, 64); err == nil && strconv.FormatInt(n, 10) == cell {
+		return int(n)
+	}
+	if f, err := strconv.ParseFloat(cell, 64); err == nil && strconv.FormatFloat(f, 'f', -1, 64) == cell {
+		return f
+	}
+	if cell == "true" || cell == "false" {
+		return cell == "true"
+	}
+	return cell
+}
+
+// matrixRows returns every combination of the values in a matrix, e.g.
+// {size: [S, M], color: [red]} returns [{size: S, color: red}, {size: M, color: red}]
+func matrixRows(matrix map[string][]interface{}) []map[string]interface{} {
+	keys := make([]string, 0, len(matrix))
+	for k := range matrix {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	rows := []map[string]interface{}{map[string]interface{}{}}
+	for _, k := range keys {
+		next := []map[string]interface{}{}
+		for _, row := range rows {
+			for _, v := range matrix[k] {
+				combined := make(map[string]interface{}, len(row)+1)
+				for rk, rv := range row {
+					combined[rk] = rv
+				}
+				combined[k] = v
+				next = append(next, combined)
+			}
+		}
+		rows = next
+	}
+	return rows
+}
+
+// expandData returns a copy of the request for every data row (and matrix combination).
+// A request without data or a matrix is returned unchanged.
+func expandData(r Request) ([]Request, error) {
+	if r.Data == nil && len(r.Matrix) == 0 {
+		return []Request{r}, nil
+	}
+
+	rows := []map[string]interface{}{map[string]interface{}{}}
+	if r.Data != nil {
+		var err error
+		rows, err = r.Data.rows()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", r.Name, err)
+		}
+	}
+	if len(r.Matrix) > 0 {
+		combined := []map[string]interface{}{}
+		for _, row := range rows {
+			for _, m := range matrixRows(r.Matrix) {
+				c := make(map[string]interface{}, len(row)+len(m))
+				for k, v := range row {
+					c[k] = v
+				}
+				for k, v := range m {
+					c[k] = v
+				}
+				combined = append(combined, c)
+			}
+		}
+		rows = combined
+	}
+
+	requests := make([]Request, 0, len(rows))
+	for i, row := range rows {
+		expanded := r
+		expanded.Data = nil
+		expanded.Matrix = nil
+
+		expanded.Vars = make(map[string]interface{}, len(r.Vars)+len(row)+1)
+		for k, v := range r.Vars {
+			expanded.Vars[k] = v
+		}
+		for k, v := range row {
+			expanded.Vars[k] = v
+		}
+		expanded.Vars["_index"] = i + 1
+
+		label := strconv.Itoa(i + 1)
+		if l, ok := row["_label"]; ok {
+			label = fmt.Sprintf("%v: %v", i+1, l)
+		} else if len(r.Matrix) > 0 {
+			label = fmt.Sprintf("%v: %s", i+1, describeRow(row))
+		}
+		expanded.Name = fmt.Sprintf("%s [%s]", r.Name, label)
+		expanded.baseName = r.Name
+
+		// each case gets its own snapshot
+		if r.Expect.Snapshot != nil {
+			s := *r.Expect.Snapshot
+			expanded.Expect.Snapshot = &s
+		}
+		requests = append(requests, expanded)
+	}
+	return requests, nil
+}
+
+// describeRow returns the row's values as key=value pairs, sorted by key.
+func describeRow(row map[string]interface{}) string {
+	pairs := []string{}
+	for _, k := range sortedKeys(row) {
+		pairs = append(pairs, fmt.Sprintf("%s=%v", k, row[k]))
+	}
+	return strings.Join(pairs, " ")
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDataDrivenRequests(t *testing.T) {
+	set, err := readTestDefinition("test/data/data.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for _, r := range set.Requests {
+		names = append(names, r.Name)
+	}
+	expectedNames := []string{
+		"Create user [1: adult]",
+		"Create user [2: minor]",
+		"Get pizza [1: crust=thin size=S]",
+		"Get pizza [2: crust=thin size=L]",
+		"Get pizza [3: crust=thick size=S]",
+		"Get pizza [4: crust=thick size=L]",
+		"Search [1]",
+		"Search [2: pears]",
+	}
+	if strings.Join(names, ",") != strings.Join(expectedNames, ",") {
+		t.Errorf("Expected '%v', received '%v'", expectedNames, names)
+	}
+
+	// CSV values keep their types when they are written like numbers
+	user := set.Requests[0]
+	if user.Vars["username"] != "alice" || user.Vars["age"] != 30 || user.Vars["code"] != "007" || user.Vars["_index"] != 1 {
+		t.Errorf("unexpected vars %v", user.Vars)
+	}
+
+	body, err := replaceBodyVars(user.Body, user.Vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body["age"] != 30 {
+		t.Errorf("Expected '%v', received '%v'", 30, body["age"])
+	}
+
+	url, err := replaceURLVars(set.Requests[3].URL, set.Requests[3].Vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "/pizzas?size=L&crust=thin" {
+		t.Errorf("Expected '%v', received '%v'", "/pizzas?size=L&crust=thin", url)
+	}
+}
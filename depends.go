@@ -0,0 +1,98 @@
+package main
+
+import "fmt"
+
+// requestResults records whether requests passed during a test run. Data driven
+// requests are also recorded under the name they were expanded from, and only
+// pass if every case passed.
+type requestResults map[string]bool
+
+func (results requestResults) record(r Request, passed bool) {
+	results[r.Name] = passed
+	if r.baseName != "" {
+		prev, ok := results[r.baseName]
+		results[r.baseName] = passed && (prev || !ok)
+	}
+}
+
+// dependencyFailed returns true and a reason if one of the request's dependencies
+// failed, was skipped or was left out of the run. It returns an error if a dependency
+// doesn't exist, or is in the list of requests being run but hasn't run yet
+// (dependencies must be listed before the requests that use them).
+func (results requestResults) dependencyFailed(r Request, requests []Request, all []Request) (bool, string, error) {
+	for _, dep := range r.DependsOn {
+		passed, ok := results[dep]
+		if !ok {
+			for _, other := range requests {
+				if other.isNamed(dep) {
+					return false, "", fmt.Errorf("depends on %s, which has not run yet", dep)
+				}
+			}
+			for _, other := range all {
+				if other.isNamed(dep) {
+					return true, fmt.Sprintf("dependency was not run: %s", dep), nil
+				}
+			}
+			return false, "", fmt.Errorf("depends on %s, which does not exist", dep)
+		}
+		if !passed {
+			return true, fmt.Sprintf("dependency failed: %s", dep), nil
+		}
+	}
+	return false, "", nil
+}
+
+// isNamed returns true if the request has the name, or was expanded from a
+// data driven request with the name.
+func (r Request) isNamed(name string) bool {
+	return r.Name == name || r.baseName == name
+}
+
+// selectRequests returns the requests that are part of the run: the requests matching
+// the --test and --tags filters, or the requests marked `only: true` if there are any.
+// The dependencies of selected requests are always included, so that a single test can
+// be run with the requests it depends on.
+func selectRequests(requests []Request, opts RunOptions) []Request {
+	selected := selectedRequests(requests, opts)
+	run := []Request{}
+	for i, r := range requests {
+		if selected[i] {
+			run = append(run, r)
+		}
+	}
+	return run
+}
+
+// selectedRequests returns true for each request that is part of the run (see selectRequests).
+func selectedRequests(requests []Request, opts RunOptions) []bool {
+	// if any request is marked with `only: true`, all other requests are left out
+	only := false
+	for _, r := range requests {
+		only = only || r.Only
+	}
+
+	selected := make([]bool, len(requests))
+	pending := []Request{}
+	for i, r := range requests {
+		if opts.selects(r) && (!only || r.Only) {
+			selected[i] = true
+			pending = append(pending, r)
+		}
+	}
+
+	// add dependencies, and their dependencies
+	for len(pending) > 0 {
+		r := pending[0]
+		pending = pending[1:]
+		for _, dep := range r.DependsOn {
+			for i, other := range requests {
+				if !selected[i] && other.isNamed(dep) {
+					selected[i] = true
+					pending = append(pending, other)
+				}
+			}
+		}
+	}
+
+	return selected
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSelectRequestsWithDependencies(t *testing.T) {
+	requests := []Request{
+		{Name: "Log in"},
+		{Name: "Create user [1]", baseName: "Create user", DependsOn: stringList{"Log in"}},
+		{Name: "Create user [2]", baseName: "Create user", DependsOn: stringList{"Log in"}},
+		{Name: "Get users", DependsOn: stringList{"Create user"}},
+		{Name: "Health check"},
+	}
+
+	names := func(requests []Request) string {
+		n := []string{}
+		for _, r := range requests {
+			n = append(n, r.Name)
+		}
+		return strings.Join(n, ",")
+	}
+
+	selected := selectRequests(requests, RunOptions{TestNames: []string{"Get users"}})
+	expected := "Log in,Create user [1],Create user [2],Get users"
+	if names(selected) != expected {
+		t.Errorf("Expected '%v', received '%v'", expected, names(selected))
+	}
+
+	selected = selectRequests(requests, RunOptions{TestNames: []string{"Health check"}})
+	if names(selected) != "Health check" {
+		t.Errorf("Expected 'Health check', received '%v'", names(selected))
+	}
+}
+
+func TestDependencyFailed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(basicRequestHandler))
+	defer server.Close()
+
+	env := Environment{Vars: map[string]interface{}{"host": server.URL}}
+	ok := Expect{Status: StatusExpectation{Codes: []int{200}}}
+	fail := Expect{Status: StatusExpectation{Codes: []int{404}}}
+	requests := []Request{
+		{Name: "Log in", URL: "{{host}}/login", Method: "get", Expect: fail},
+		{Name: "Get profile", URL: "{{host}}/profile", Method: "get", Expect: ok, DependsOn: stringList{"Log in"}},
+		{Name: "Get settings", URL: "{{host}}/settings", Method: "get", Expect: ok, DependsOn: stringList{"Get profile"}},
+		{Name: "Health check", URL: "{{host}}/health", Method: "get", Expect: ok},
+	}
+
+	summary := runRequests(requests, env, RunOptions{})
+	if summary.Total != 2 || summary.Failed != 1 || summary.Skipped != 2 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+
+	// requests with a missing dependency, or one that runs later, fail and are counted
+	broken := []Request{
+		{Name: "Get profile", URL: "{{host}}/profile", Method: "get", Expect: ok, DependsOn: stringList{"Log in"}},
+		{Name: "Log in", URL: "{{host}}/login", Method: "get", Expect: ok},
+		{Name: "Get settings", URL: "{{host}}/settings", Method: "get", Expect: ok, DependsOn: stringList{"Missing"}},
+	}
+	summary = runRequests(broken, env, RunOptions{})
+	if summary.Total != 3 || summary.Failed != 2 || summary.Skipped != 0 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+
+	results := requestResults{}
+	if _, _, err := results.dependencyFailed(requests[1], requests, requests); err == nil {
+		t.Error("expected an error for a dependency that has not run")
+	}
+	missing := Request{Name: "x", DependsOn: stringList{"Missing"}}
+	if _, _, err := results.dependencyFailed(missing, requests, requests); err == nil {
+		t.Error("expected an error for a dependency that does not exist")
+	}
+
+	// a data driven dependency passes only if every case passed
+	results.record(Request{Name: "Create user [1]", baseName: "Create user"}, true)
+	results.record(Request{Name: "Create user [2]", baseName: "Create user"}, false)
+	results.record(Request{Name: "Create user [3]", baseName: "Create user"}, true)
+	if skip, reason, _ := results.dependencyFailed(Request{DependsOn: stringList{"Create user"}}, nil, nil); !skip || reason != "dependency failed: Create user" {
+		t.Errorf("expected dependency to fail, received %v %s", skip, reason)
+	}
+}
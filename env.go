@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// buildEnvironment creates the environment for a test run. Each layer overrides
+// values from the layers before it:
+//  1. the `environment` block in the test spec
+//  2. the named environment profile selected with --profile (from the `environments` block)
+//  3. variables from .env files (--env-file), in the order the files were given
+//  4. variables from the command line (-e)
+//  5. secrets defined in the spec, then secrets from the command line (-s)
+//
+// Group vars override the first two layers, but not vars from the later layers.
+func buildEnvironment(set TestSet, profile string, envFiles []string, userVars []string, userSecrets []string) (Environment, error) {
+	env := Environment{fixed: make(map[string]bool)}
+	env.merge(set.Environment)
+
+	if profile != "" {
+		p, ok := set.Environments[profile]
+		if !ok {
+			return env, fmt.Errorf("environment profile %s not found in test spec", profile)
+		}
+		env.merge(p)
+	}
+
+	for _, filename := range envFiles {
+		vars, err := readEnvFile(filename)
+		if err != nil {
+			return env, err
+		}
+		for k, v := range vars {
+			env.Vars[k] = v
+			env.fix(k)
+		}
+	}
+
+	if err := env.processEnvVars(userVars); err != nil {
+		return env, err
+	}
+	if err := env.processSecrets(env.Secrets, userSecrets); err != nil {
+		return env, err
+	}
+	return env, nil
+}
+
+// merge copies values from another environment into this one, overriding existing
+// values. Maps are copied so that environments never share vars or headers.
+func (env *Environment) merge(other Environment) {
+	vars := make(map[string]interface{}, len(env.Vars)+len(other.Vars))
+	for k, v := range env.Vars {
+		vars[k] = v
+	}
+	for k, v := range other.Vars {
+		vars[k] = v
+	}
+	env.Vars = vars
+
+	headers := make(map[string]string, len(env.Headers)+len(other.Headers))
+	for k, v := range env.Headers {
+		headers[k] = v
+	}
+	for k, v := range other.Headers {
+		headers[k] = v
+	}
+	env.Headers = headers
+
+	if other.MaxDuration.Duration != 0 {
+		env.MaxDuration = other.MaxDuration
+	}
+
+	env.Secrets = append(append([]Secret{}, env.Secrets...), other.Secrets...)
+
+	if other.Auth != nil {
+		env.Auth = other.Auth
+	}
+
+	// TLS settings are merged, so that a profile can override a single setting
+	if other.TLS != nil {
+		tlsConfig := TLSConfig{}
+		tlsConfig.merge(env.TLS)
+		tlsConfig.merge(other.TLS)
+		env.TLS = &tlsConfig
+	}
+}
+
+// fix marks a var so that group vars don't override it (see testRun.groupVars).
+func (env Environment) fix(name string) {
+	if env.fixed != nil {
+		env.fixed[name] = true
+	}
+}
+
+// readEnvFile reads variables from a .env file. Each line has the form KEY=value.
+// Blank lines and lines starting with # are ignored, an optional `export ` prefix
+// is allowed, and values may be surrounded by single or double quotes.
+func readEnvFile(filename string) (map[string]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("could not open env file: %v", err)
+	}
+	defer f.Close()
+
+	vars := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		i := strings.Index(line, "=")
+		if i < 1 {
+			return nil, fmt.Errorf("%s line %v: expected KEY=value", filename, lineNumber)
+		}
+		key := strings.TrimSpace(line[:i])
+		value := strings.TrimSpace(line[i+1:])
+
+		switch {
+		case len(value) > 1 && value[0] == '"' && value[len(value)-1] == '"':
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s line %v: invalid quoted value", filename, lineNumber)
+			}
+			value = unquoted
+		case len(value) > 1 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+		default:
+			// remove trailing comments from unquoted values
+			if j := strings.Index(value, " #"); j >= 0 {
+				value = strings.TrimSpace(value[:j])
+			}
+		}
+
+		vars[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read env file: %v", err)
+	}
+	return vars, nil
+}
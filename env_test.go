@@ -0,0 +1,108 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestReadEnvFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "apitest.env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	f.WriteString(`# comment
+HOST=http://localhost:8000
+export TOKEN="secret 123"
+QUOTED='single # quoted'
+WITH_COMMENT=value # comment
+EQUALS=a=b
+
+`)
+	f.Close()
+
+	vars, err := readEnvFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"HOST":         "http://localhost:8000",
+		"TOKEN":        "secret 123",
+		"QUOTED":       "single # quoted",
+		"WITH_COMMENT": "value",
+		"EQUALS":       "a=b",
+	}
+	for k, v := range expected {
+		if vars[k] != v {
+			t.Errorf("%s: expected '%v', received '%v'", k, v, vars[k])
+		}
+	}
+	if len(vars) != len(expected) {
+		t.Errorf("Expected %v vars, received %v", len(expected), len(vars))
+	}
+}
+
+func TestBuildEnvironment(t *testing.T) {
+	spec := `
+environment:
+  vars:
+    host: http://localhost
+    user: base
+    mode: base
+  headers:
+    Accept: application/json
+environments:
+  staging:
+    vars:
+      host: https://staging.example.com
+      user: staging
+    headers:
+      X-Env: staging
+`
+	set := TestSet{}
+	if err := yaml.Unmarshal([]byte(spec), &set); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := ioutil.TempFile("", "apitest.env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("user=envfile\ntoken=abc\n")
+	f.Close()
+
+	env, err := buildEnvironment(set, "staging", []string{f.Name()}, []string{"token=cli"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"host":  "https://staging.example.com",
+		"user":  "envfile",
+		"mode":  "base",
+		"token": "cli",
+	}
+	for k, v := range expected {
+		if env.Vars[k] != v {
+			t.Errorf("%s: expected '%v', received '%v'", k, v, env.Vars[k])
+		}
+	}
+	if env.Headers["Accept"] != "application/json" || env.Headers["X-Env"] != "staging" {
+		t.Errorf("unexpected headers %v", env.Headers)
+	}
+
+	// the base environment is not modified by the profile
+	if set.Environment.Vars["host"] != "http://localhost" {
+		t.Errorf("Expected '%v', received '%v'", "http://localhost", set.Environment.Vars["host"])
+	}
+
+	if _, err := buildEnvironment(set, "prod", nil, nil, nil); err == nil {
+		t.Error("expected an error for a missing profile")
+	}
+}
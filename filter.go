@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// testPattern compiles a --test value into a regular expression that matches request names.
+// A value surrounded by slashes (/^Get .*/) is a regular expression, a value containing *
+// or ? is a glob (* matches any text, ? matches one character), and anything else must
+// match the name exactly.
+func testPattern(pattern string) (*regexp.Regexp, error) {
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid test pattern %s: %v", pattern, err)
+		}
+		return re, nil
+	}
+
+	quoted := regexp.QuoteMeta(pattern)
+	quoted = strings.Replace(quoted, `\*`, ".*", -1)
+	quoted = strings.Replace(quoted, `\?`, ".", -1)
+	return regexp.MustCompile("^" + quoted + "$"), nil
+}
+
+// checkFilters returns an error if any of the --test patterns or --tags are invalid.
+func (opts RunOptions) checkFilters() error {
+	for _, p := range opts.TestNames {
+		if _, err := testPattern(p); err != nil {
+			return err
+		}
+	}
+	for _, tag := range opts.Tags {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "!") == "" {
+			return fmt.Errorf("invalid tag filter %q", tag)
+		}
+	}
+	return nil
+}
+
+// selects returns true if a request should be part of the run.
+// A request is selected if its name, or the name of a group it's in, matches any of
+// the test name patterns (or no patterns were given), has at least one of the tags asked for (if any), and none
+// of the excluded (!tag) tags.
+func (opts RunOptions) selects(r Request) bool {
+	if len(opts.TestNames) > 0 {
+		matched := false
+		names := append([]string{r.Name}, r.groupNames()...)
+		for _, p := range opts.TestNames {
+			re, err := testPattern(p)
+			if err != nil {
+				continue
+			}
+			for _, name := range names {
+				matched = matched || re.MatchString(name)
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	included, wanted := false, false
+	for _, tag := range opts.Tags {
+		tag = strings.TrimSpace(tag)
+		if strings.HasPrefix(tag, "!") {
+			if r.hasTag(tag[1:]) {
+				return false
+			}
+			continue
+		}
+		wanted = true
+		included = included || r.hasTag(tag)
+	}
+	return included || !wanted
+}
+
+// hasTag returns true if the request is tagged with tag
+func (r Request) hasTag(tag string) bool {
+	for _, t := range r.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
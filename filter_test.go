@@ -0,0 +1,80 @@
+package main
+
+import "testing"
+
+func TestTestPattern(t *testing.T) {
+	cases := []struct {
+		pattern string
+		name    string
+		matched bool
+	}{
+		{"Todo list", "Todo list", true},
+		{"Todo list", "Todo list 2", false},
+		{"Todo*", "Todo list", true},
+		{"Todo ?ist", "Todo list", true},
+		{"*user [1*", "Create user [1: adult]", true},
+		{"Create user [1: adult]", "Create user [1: adult]", true},
+		{"/^(Get|List) /", "List todos", true},
+		{"/^(Get|List) /", "Create todo", false},
+	}
+
+	for _, c := range cases {
+		re, err := testPattern(c.pattern)
+		if err != nil {
+			t.Errorf("%s: %v", c.pattern, err)
+			continue
+		}
+		if re.MatchString(c.name) != c.matched {
+			t.Errorf("%s matching %s: expected %v", c.pattern, c.name, c.matched)
+		}
+	}
+
+	if _, err := testPattern("/(/"); err == nil {
+		t.Error("expected an error for an invalid regex")
+	}
+}
+
+func TestSelects(t *testing.T) {
+	requests := []Request{
+		{Name: "Health check", Tags: stringList{"smoke", "monitor"}},
+		{Name: "Get todo", Tags: stringList{"smoke"}},
+		{Name: "Export", Tags: stringList{"slow"}},
+		{Name: "Untagged"},
+	}
+
+	cases := []struct {
+		opts     RunOptions
+		expected []string
+	}{
+		{RunOptions{}, []string{"Health check", "Get todo", "Export", "Untagged"}},
+		{RunOptions{Tags: []string{"smoke"}}, []string{"Health check", "Get todo"}},
+		{RunOptions{Tags: []string{"!slow"}}, []string{"Health check", "Get todo", "Untagged"}},
+		{RunOptions{Tags: []string{"smoke", "!monitor"}}, []string{"Get todo"}},
+		{RunOptions{Tags: []string{"slow", "monitor"}}, []string{"Health check", "Export"}},
+		{RunOptions{TestNames: []string{"Get*", "Export"}}, []string{"Get todo", "Export"}},
+		{RunOptions{TestNames: []string{"/e/"}, Tags: []string{"!smoke"}}, []string{"Untagged"}},
+	}
+
+	for _, c := range cases {
+		selected := []string{}
+		for _, r := range requests {
+			if c.opts.selects(r) {
+				selected = append(selected, r.Name)
+			}
+		}
+		if len(selected) != len(c.expected) {
+			t.Errorf("%+v: expected %v, received %v", c.opts, c.expected, selected)
+			continue
+		}
+		for i := range selected {
+			if selected[i] != c.expected[i] {
+				t.Errorf("%+v: expected %v, received %v", c.opts, c.expected, selected)
+				break
+			}
+		}
+	}
+
+	if err := (RunOptions{Tags: []string{"!"}}).checkFilters(); err == nil {
+		t.Error("expected an error for an empty tag")
+	}
+}
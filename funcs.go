@@ -0,0 +1,187 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"math/big"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// templateFuncs are the functions available in template tags, e.g.
+// {{ uuid }} or {{ now | dateAdd "24h" | date "2006-01-02" }}.
+// When used with a pipe, the piped value is passed as the last argument.
+// Functions return a value, or a value and an error.
+var templateFuncs = map[string]interface{}{
+	"uuid":         uuid,
+	"now":          time.Now,
+	"date":         formatDate,
+	"dateAdd":      dateAdd,
+	"randomInt":    randomInt,
+	"randomString": randomString,
+	"base64":       base64Encode,
+	"urlencode":    url.QueryEscape,
+	"sha256":       sha256Hex,
+	"hmac":         hmacHex,
+	"env":          os.Getenv,
+	"jsonEncode":   jsonEncode,
+	"default":      defaultValue,
+	"upper":        strings.ToUpper,
+	"lower":        strings.ToLower,
+	"trim":         strings.TrimSpace,
+	"len":          length,
+}
+
+// dateLayouts are named layouts that can be used with the date function
+// in addition to Go time layouts (e.g. "2006-01-02").
+var dateLayouts = map[string]string{
+	"RFC3339":  time.RFC3339,
+	"RFC1123":  time.RFC1123,
+	"ISO8601":  "2006-01-02T15:04:05Z0700",
+	"dateOnly": "2006-01-02",
+}
+
+const randomChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// uuid returns a random (version 4) UUID
+func uuid() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// formatDate formats a time using a Go time layout, one of the named layouts above,
+// or "unix" / "unixMilli" for a unix timestamp.
+func formatDate(layout string, t time.Time) string {
+	switch layout {
+	case "unix":
+		return strconv.FormatInt(t.Unix(), 10)
+	case "unixMilli":
+		return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+	}
+	if l, ok := dateLayouts[layout]; ok {
+		layout = l
+	}
+	return t.Format(layout)
+}
+
+// dateAdd adds a duration (e.g. "1h30m" or "-2h") to a time.
+// Days can also be used, e.g. "7d" or "-1d".
+func dateAdd(duration string, t time.Time) (time.Time, error) {
+	if strings.HasSuffix(duration, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(duration, "d"))
+		if err != nil {
+			return t, fmt.Errorf("invalid duration %s", duration)
+		}
+		return t.AddDate(0, 0, days), nil
+	}
+	d, err := time.ParseDuration(duration)
+	if err != nil {
+		return t, fmt.Errorf("invalid duration %s", duration)
+	}
+	return t.Add(d), nil
+}
+
+// randomInt returns a random integer between min and max (inclusive)
+func randomInt(min int, max int) (int, error) {
+	if max < min {
+		return 0, fmt.Errorf("max %v is less than min %v", max, min)
+	}
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(max-min+1)))
+	if err != nil {
+		return 0, err
+	}
+	return min + int(n.Int64()), nil
+}
+
+// randomString returns a random string of letters and numbers
+func randomString(length int) (string, error) {
+	b := make([]byte, length)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(randomChars))))
+		if err != nil {
+			return "", err
+		}
+		b[i] = randomChars[n.Int64()]
+	}
+	return string(b), nil
+}
+
+func base64Encode(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// hmacHex returns the hex encoded HMAC of a message, using the algorithm
+// (md5, sha1, sha256 or sha512) and key provided.
+func hmacHex(algorithm string, key string, message string) (string, error) {
+	h, err := hashFunc(algorithm)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(h, []byte(key))
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// hashFunc returns the hash function for an algorithm name (md5, sha1, sha256 or sha512)
+func hashFunc(algorithm string) (func() hash.Hash, error) {
+	switch strings.ToLower(algorithm) {
+	case "md5":
+		return md5.New, nil
+	case "sha1":
+		return sha1.New, nil
+	case "sha256":
+		return sha256.New, nil
+	case "sha512":
+		return sha512.New, nil
+	}
+	return nil, fmt.Errorf("unsupported algorithm %s", algorithm)
+}
+
+func jsonEncode(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// defaultValue returns value, or the default if value is empty (nil, "" or missing).
+func defaultValue(def interface{}, value interface{}) interface{} {
+	if value == nil || value == "" {
+		return def
+	}
+	return value
+}
+
+// length returns the length of a string, list or map
+func length(value interface{}) (int, error) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return v.Len(), nil
+	}
+	return 0, fmt.Errorf("can't get the length of %v", value)
+}
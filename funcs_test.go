@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+	os.Setenv("APITEST_FUNC_TEST", "from env")
+	defer os.Unsetenv("APITEST_FUNC_TEST")
+
+	vars := map[string]interface{}{
+		"name":   "alice",
+		"secret": "key",
+		"user":   map[string]interface{}{"id": 1},
+	}
+
+	type testCase struct {
+		Template string
+		Expected string
+	}
+
+	cases := []testCase{
+		testCase{Template: `{{ "hello" | base64 }}`, Expected: "aGVsbG8="},
+		testCase{Template: `{{ urlencode "a b&c" }}`, Expected: "a+b%26c"},
+		testCase{Template: `{{ sha256 "abc" }}`, Expected: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		testCase{Template: `{{ .name | hmac "sha256" .secret }}`, Expected: "76fb55e929c06b97b01c35950ee5f72fe415b15ed3a7356c39e709906dbb5c45"},
+		testCase{Template: `{{ env "APITEST_FUNC_TEST" }}`, Expected: "from env"},
+		testCase{Template: `{{ jsonEncode .user }}`, Expected: `{"id":1}`},
+		testCase{Template: `{{ default "bob" .missing }}`, Expected: "bob"},
+		testCase{Template: `{{ default "bob" .name }}`, Expected: "alice"},
+		testCase{Template: `{{ randomString 12 | len }}`, Expected: "12"},
+	}
+
+	for _, c := range cases {
+		out, err := renderTemplate("test", c.Template, vars)
+		if err != nil {
+			t.Errorf("%s: %v", c.Template, err)
+			continue
+		}
+		if out != c.Expected {
+			t.Errorf("%s: expected '%v', received '%v'", c.Template, c.Expected, out)
+		}
+	}
+}
+
+func TestRandomTemplateFuncs(t *testing.T) {
+	out, err := renderTemplate("test", `{{ uuid }}`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(out) {
+		t.Errorf("invalid uuid %s", out)
+	}
+
+	for i := 0; i < 20; i++ {
+		n, err := randomInt(5, 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n < 5 || n > 7 {
+			t.Errorf("randomInt(5, 7) returned %v", n)
+		}
+	}
+}
+
+func TestDateFuncs(t *testing.T) {
+	d := time.Date(2019, 4, 1, 10, 0, 0, 0, time.UTC)
+
+	if out := formatDate("dateOnly", d); out != "2019-04-01" {
+		t.Errorf("Expected '%v', received '%v'", "2019-04-01", out)
+	}
+	if out := formatDate("unix", d); out != "1554112800" {
+		t.Errorf("Expected '%v', received '%v'", "1554112800", out)
+	}
+
+	later, err := dateAdd("7d", d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := formatDate("2006-01-02", later); out != "2019-04-08" {
+		t.Errorf("Expected '%v', received '%v'", "2019-04-08", out)
+	}
+
+	earlier, err := dateAdd("-90m", d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := formatDate("RFC3339", earlier); out != "2019-04-01T08:30:00Z" {
+		t.Errorf("Expected '%v', received '%v'", "2019-04-01T08:30:00Z", out)
+	}
+
+	if _, err := dateAdd("soon", d); err == nil {
+		t.Error("expected an invalid duration to return an error")
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// groupSeparator separates group names in the names of requests in groups,
+// e.g. "Orders > Create > happy path"
+const groupSeparator = " > "
+
+// Group is a named set of requests in a test spec. A group's environment overrides the
+// vars, headers and maxDuration of the test spec's environment for requests in the group.
+// Groups can have their own setup and teardown requests, and nested groups.
+type Group struct {
+	// Name is the full name of the group, including the names of the groups it's in
+	Name        string
+	Environment Environment
+	// Tags are added to every request in the group
+	Tags     stringList
+	Setup    []Request
+	Requests []Request
+	Teardown []Request
+	Groups   []Group
+}
+
+// groupSpec is the raw content of a group in a test spec file, before its requests are loaded.
+type groupSpec struct {
+	Name        string      `yaml:"name"`
+	Environment Environment `yaml:"environment"`
+	Tags        stringList  `yaml:"tags"`
+	Setup       []yaml.Node `yaml:"setup"`
+	Requests    []yaml.Node `yaml:"requests"`
+	Teardown    []yaml.Node `yaml:"teardown"`
+	Groups      []yaml.Node `yaml:"groups"`
+}
+
+// loadGroups decodes a list of groups and their nested groups. The requests in each group
+// are named with the group's name, and `depends_on` names of requests in the same group
+// are changed to the full name.
+func (l *specLoader) loadGroups(nodes []yaml.Node, parent Group, filename string, templates map[string]*yaml.Node, included *TestSet) ([]Group, error) {
+	groups := []Group{}
+	for i := range nodes {
+		spec := groupSpec{}
+		if err := nodes[i].Decode(&spec); err != nil {
+			return nil, fmt.Errorf("Unmarshal %s: %v", filename, err)
+		}
+		if spec.Name == "" {
+			return nil, fmt.Errorf("%s: group on line %v has no name", filename, nodes[i].Line)
+		}
+
+		spec.Environment.TLS.resolveFiles(filename)
+		g := Group{Name: spec.Name, Environment: spec.Environment}
+		if parent.Name != "" {
+			g.Name = parent.Name + groupSeparator + spec.Name
+		}
+		g.Tags = append(append(stringList{}, parent.Tags...), spec.Tags...)
+
+		var err error
+		if g.Setup, err = l.loadRequests(spec.Setup, filename, templates, included); err != nil {
+			return nil, err
+		}
+		if g.Requests, err = l.loadRequests(spec.Requests, filename, templates, included); err != nil {
+			return nil, err
+		}
+		if g.Teardown, err = l.loadRequests(spec.Teardown, filename, templates, included); err != nil {
+			return nil, err
+		}
+		g.nameRequests(filename)
+
+		if g.Groups, err = l.loadGroups(spec.Groups, g, filename, templates, included); err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	return groups, nil
+}
+
+// nameRequests adds the group's name to the names of its requests, and to dependencies
+// on other requests in the group. The group's tags are added to its requests.
+func (g *Group) nameRequests(filename string) {
+	local := map[string]bool{}
+	for _, list := range [][]Request{g.Setup, g.Requests, g.Teardown} {
+		for _, r := range list {
+			local[r.Name] = true
+			if r.baseName != "" {
+				local[r.baseName] = true
+			}
+		}
+	}
+
+	prefix := g.Name + groupSeparator
+	for _, list := range [][]Request{g.Setup, g.Requests, g.Teardown} {
+		for i := range list {
+			r := &list[i]
+			r.Name = prefix + r.Name
+			if r.baseName != "" {
+				r.baseName = prefix + r.baseName
+			}
+			r.group = g.Name
+			r.Tags = append(append(stringList{}, g.Tags...), r.Tags...)
+
+			deps := stringList{}
+			for _, dep := range r.DependsOn {
+				if local[dep] {
+					dep = prefix + dep
+				}
+				deps = append(deps, dep)
+			}
+			r.DependsOn = deps
+
+			if r.Expect.Snapshot != nil {
+				r.Expect.Snapshot.path = snapshotPath(filename, r.Name)
+			}
+		}
+	}
+}
+
+// allRequests returns the requests in the group and its nested groups, in the order
+// they run. Setup and teardown requests are not included.
+func (g Group) allRequests() []Request {
+	requests := append([]Request{}, g.Requests...)
+	for _, sub := range g.Groups {
+		requests = append(requests, sub.allRequests()...)
+	}
+	return requests
+}
+
+// everyRequest returns every request in the group and its nested groups, including
+// setup and teardown requests.
+func (g Group) everyRequest() []Request {
+	requests := append(append(append([]Request{}, g.Setup...), g.Requests...), g.Teardown...)
+	for _, sub := range g.Groups {
+		requests = append(requests, sub.everyRequest()...)
+	}
+	return requests
+}
+
+// filter returns a copy of the group with only the selected requests, where selected
+// has a value for each request returned by allRequests, starting at index i.
+// It returns false if the group and its nested groups have no selected requests.
+func (g Group) filter(selected []bool, i *int) (Group, bool) {
+	filtered := g
+	filtered.Requests = []Request{}
+	filtered.Groups = []Group{}
+	for _, r := range g.Requests {
+		if selected[*i] {
+			filtered.Requests = append(filtered.Requests, r)
+		}
+		*i++
+	}
+	for _, sub := range g.Groups {
+		if s, ok := sub.filter(selected, i); ok {
+			filtered.Groups = append(filtered.Groups, s)
+		}
+	}
+	return filtered, len(filtered.Requests) > 0 || len(filtered.Groups) > 0
+}
+
+// runGroup runs a group's setup requests, requests, nested groups and teardown requests,
+// using the group's environment. See runTestSet.
+func (t *testRun) runGroup(g Group) (RunSummary, RunSummary) {
+	// nothing in the group runs if the test run has been stopped
+	if t.stopped != "" {
+		return t.run(g.allRequests()), RunSummary{}
+	}
+
+	parentEnv, parentVars := t.env, t.vars
+	t.env, t.vars = g.environment(parentEnv, parentVars)
+	if g.Environment.TLS != nil {
+		// TLS settings from the command line override the group's settings
+		t.env.TLS = t.opts.tlsConfig(t.env.TLS)
+	}
+	defer func() { t.env, t.vars = parentEnv, parentVars }()
+
+	phase := func(name string) {
+		if g.Name == "" {
+			log.Printf("%s...", name)
+		} else {
+			log.Printf("%s %s...", name, g.Name)
+		}
+	}
+
+	summary := RunSummary{}
+	if len(g.Setup) > 0 {
+		phase("Setup")
+		summary = t.run(g.Setup)
+	}
+
+	teardown := RunSummary{}
+	if summary.Failed > 0 && t.stopped == "" {
+		for _, r := range g.allRequests() {
+			log.Printf("   SKIP %s (setup failed)", r.Name)
+			t.results.record(r, false)
+			summary.Skipped++
+		}
+	} else {
+		summary.add(t.run(g.Requests))
+		for _, sub := range g.Groups {
+			s, td := t.runGroup(sub)
+			summary.add(s)
+			teardown.add(td)
+		}
+	}
+
+	if len(g.Teardown) > 0 {
+		phase("Teardown")
+		stopped, inTeardown := t.stopped, t.teardown
+		t.stopped, t.teardown = "", true
+		teardown.add(t.run(g.Teardown))
+		t.stopped, t.teardown = stopped, inTeardown
+	}
+	return summary, teardown
+}
+
+// environment returns the environment for requests in the group, and the group vars
+// (see testRun.groupVars). Environment vars are shared with the rest of the test run,
+// so that vars set by requests in the group can be used by later requests.
+func (g Group) environment(parent Environment, parentVars map[string]interface{}) (Environment, map[string]interface{}) {
+	env := parent
+	if len(g.Environment.Headers) > 0 {
+		env.Headers = make(map[string]string, len(parent.Headers)+len(g.Environment.Headers))
+		for k, v := range parent.Headers {
+			env.Headers[k] = v
+		}
+		for k, v := range g.Environment.Headers {
+			env.Headers[k] = v
+		}
+	}
+	if g.Environment.MaxDuration.Duration > 0 {
+		env.MaxDuration = g.Environment.MaxDuration
+	}
+	if g.Environment.Auth != nil {
+		env.Auth = g.Environment.Auth
+	}
+	if g.Environment.TLS != nil {
+		tlsConfig := TLSConfig{}
+		tlsConfig.merge(parent.TLS)
+		tlsConfig.merge(g.Environment.TLS)
+		env.TLS = &tlsConfig
+	}
+
+	if len(g.Environment.Vars) == 0 {
+		return env, parentVars
+	}
+	return env, overlayVars(parentVars, g.Environment.Vars)
+}
+
+// overlayVars returns a new map with the vars from base and over. Values in over take precedence.
+func overlayVars(base map[string]interface{}, over map[string]interface{}) map[string]interface{} {
+	vars := make(map[string]interface{}, len(base)+len(over))
+	for k, v := range base {
+		vars[k] = v
+	}
+	for k, v := range over {
+		vars[k] = v
+	}
+	return vars
+}
+
+// groupNames returns the full names of the groups the request is in, e.g.
+// "Orders" and "Orders > Create".
+func (r Request) groupNames() []string {
+	if r.group == "" {
+		return nil
+	}
+	parts := strings.Split(r.group, groupSeparator)
+	names := make([]string, len(parts))
+	for i := range parts {
+		names[i] = strings.Join(parts[:i+1], groupSeparator)
+	}
+	return names
+}
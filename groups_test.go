@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLoadGroups(t *testing.T) {
+	set, err := readTestDefinition("test/groups/groups.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := Group{Setup: set.Setup, Requests: set.Requests, Teardown: set.Teardown, Groups: set.Groups}
+	names := []string{}
+	for _, r := range root.everyRequest() {
+		names = append(names, r.Name)
+	}
+	expected := "Health check,Orders > Create customer,Orders > List orders,Orders > Delete customer,Orders > Create > happy path,Users > List users"
+	if strings.Join(names, ",") != expected {
+		t.Errorf("Expected '%v', received '%v'", expected, strings.Join(names, ","))
+	}
+
+	orders := set.Groups[0]
+	if deps := orders.Requests[0].DependsOn; len(deps) != 1 || deps[0] != "Orders > Create customer" {
+		t.Errorf("unexpected dependencies %v", deps)
+	}
+	happyPath := orders.Groups[0].Requests[0]
+	if strings.Join(happyPath.Tags, ",") != "orders,smoke" {
+		t.Errorf("unexpected tags %v", happyPath.Tags)
+	}
+	if strings.Join(happyPath.groupNames(), ",") != "Orders,Orders > Create" {
+		t.Errorf("unexpected group names %v", happyPath.groupNames())
+	}
+}
+
+func TestRunGroups(t *testing.T) {
+	var mu sync.Mutex
+	seen := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		seen = append(seen, req.URL.RequestURI()+" "+req.Header.Get("X-Team"))
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	set, err := readTestDefinition("test/groups/groups.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	set.Environment.Vars["host"] = server.URL
+
+	cases := []struct {
+		opts     RunOptions
+		expected string
+	}{
+		{RunOptions{}, "/health ,/customers orders,/orders?status=pending orders,/orders orders,/customers orders,/users?status=active "},
+		// group names select every request in the group, and the group's setup and teardown run
+		{RunOptions{TestNames: []string{"Orders > Create"}}, "/customers orders,/orders orders,/customers orders"},
+		{RunOptions{TestNames: []string{"Users"}}, "/users?status=active "},
+		{RunOptions{Tags: []string{"orders", "!smoke"}}, "/customers orders,/orders?status=pending orders,/customers orders"},
+	}
+
+	for _, c := range cases {
+		seen = []string{}
+		summary, _ := runTestSet(set, c.opts)
+		if summary.Failed != 0 {
+			t.Errorf("%+v: unexpected summary %+v", c.opts, summary)
+		}
+		if strings.Join(seen, ",") != c.expected {
+			t.Errorf("%+v: expected '%v', received '%v'", c.opts, c.expected, strings.Join(seen, ","))
+		}
+	}
+}
+
+func TestGroupVarPrecedence(t *testing.T) {
+	var mu sync.Mutex
+	seen := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		seen = append(seen, req.URL.RequestURI())
+		mu.Unlock()
+		w.Header().Set("X-Status", "captured")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	group := Group{
+		Name:        "Orders",
+		Environment: Environment{Vars: map[string]interface{}{"status": "pending", "limit": 5}},
+		Requests: []Request{
+			{Name: "Orders > list", URL: "{{host}}/orders?status={{status}}&limit={{limit}}", Method: "get",
+				SetVars: []UserVar{{Name: "status", Header: "X-Status"}}},
+			{Name: "Orders > list again", URL: "{{host}}/orders?status={{status}}&limit={{limit}}", Method: "get"},
+		},
+	}
+	set := TestSet{
+		Environment: Environment{Vars: map[string]interface{}{"host": server.URL, "status": "active", "limit": 1}},
+		Groups:      []Group{group},
+	}
+
+	// group vars override the spec's environment, but not -e vars or vars set by requests
+	env, err := buildEnvironment(set, "", nil, []string{"limit=10"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set.Environment = env
+	summary, _ := runTestSet(set, RunOptions{})
+	if summary.Failed != 0 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+	expected := "/orders?status=pending&limit=10,/orders?status=captured&limit=10"
+	if strings.Join(seen, ",") != expected {
+		t.Errorf("expected '%v', received '%v'", expected, strings.Join(seen, ","))
+	}
+}
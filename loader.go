@@ -0,0 +1,279 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// specFile is the raw content of a test spec file, before includes and
+// request templates (`extends`) have been resolved.
+type specFile struct {
+	Include      stringList             `yaml:"include"`
+	Templates    map[string]yaml.Node   `yaml:"templates"`
+	Requests     []yaml.Node            `yaml:"requests"`
+	Setup        []yaml.Node            `yaml:"setup"`
+	Teardown     []yaml.Node            `yaml:"teardown"`
+	Groups       []yaml.Node            `yaml:"groups"`
+	Environment  Environment            `yaml:"environment"`
+	Environments map[string]Environment `yaml:"environments"`
+}
+
+// specLoader reads test spec files, keeping track of the files currently being
+// loaded so that include cycles can be reported.
+type specLoader struct {
+	stack []string
+}
+
+// loadSpecFile reads a test spec file and the files it includes, returning a single TestSet.
+//
+// Files listed under the top level `include:` key have their environments merged
+// (the including file's values take precedence), their request templates made available,
+// and their requests added before the including file's requests. An item in the
+// requests list can also be `- include: file.yaml`, which inserts that file's
+// requests in place. Include paths are relative to the including file.
+// The same applies to the setup list and to groups. Teardown runs in reverse: the including
+// file's teardown requests come first, then those of included files, last included first,
+// so fixtures are cleaned up in the reverse order they were created.
+//
+// Requests can use `extends: name` to start from a request template defined under
+// the `templates:` key. Values in the request override the template's values, and
+// nested blocks (e.g. expect) are merged.
+func (l *specLoader) loadSpecFile(filename string, templates map[string]*yaml.Node) (TestSet, error) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return TestSet{}, err
+	}
+	for i, f := range l.stack {
+		if f == abs {
+			cycle := append(append([]string{}, l.stack[i:]...), abs)
+			return TestSet{}, fmt.Errorf("include cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	l.stack = append(l.stack, abs)
+	defer func() { l.stack = l.stack[:len(l.stack)-1] }()
+
+	// Read in a yaml file containing test specs
+	file, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return TestSet{}, fmt.Errorf("File open error %v ", err)
+	}
+
+	// convert yaml to structs.
+	spec := specFile{}
+	err = yaml.Unmarshal(file, &spec)
+	if err != nil {
+		return TestSet{}, fmt.Errorf("Unmarshal %s: %v", filename, err)
+	}
+
+	// secret files are found relative to the test spec file
+	resolveSecretFiles(spec.Environment.Secrets, filename)
+	spec.Environment.TLS.resolveFiles(filename)
+	for _, env := range spec.Environments {
+		resolveSecretFiles(env.Secrets, filename)
+		env.TLS.resolveFiles(filename)
+	}
+
+	set := TestSet{Environments: make(map[string]Environment)}
+	included := TestSet{Environments: make(map[string]Environment)}
+
+	// templates from included files are available to this file
+	if templates == nil {
+		templates = make(map[string]*yaml.Node)
+	}
+
+	for _, inc := range spec.Include {
+		s, err := l.loadSpecFile(filepath.Join(filepath.Dir(filename), inc), templates)
+		if err != nil {
+			return TestSet{}, err
+		}
+		mergeTestSet(&included, s)
+	}
+
+	for name := range spec.Templates {
+		t := spec.Templates[name]
+		templates[name] = &t
+	}
+
+	if set.Setup, err = l.loadRequests(spec.Setup, filename, templates, &included); err != nil {
+		return TestSet{}, err
+	}
+	if set.Requests, err = l.loadRequests(spec.Requests, filename, templates, &included); err != nil {
+		return TestSet{}, err
+	}
+	if set.Teardown, err = l.loadRequests(spec.Teardown, filename, templates, &included); err != nil {
+		return TestSet{}, err
+	}
+	if set.Groups, err = l.loadGroups(spec.Groups, Group{}, filename, templates, &included); err != nil {
+		return TestSet{}, err
+	}
+
+	// requests from included files run first, and their teardown runs last. environments
+	// from included files are merged under this file's environment
+	set.Setup = append(included.Setup, set.Setup...)
+	set.Requests = append(included.Requests, set.Requests...)
+	set.Teardown = append(set.Teardown, included.Teardown...)
+	set.Groups = append(included.Groups, set.Groups...)
+	mergeTestSet(&set, TestSet{Environment: included.Environment, Environments: included.Environments})
+	mergeTestSet(&set, TestSet{Environment: spec.Environment, Environments: spec.Environments})
+
+	return set, nil
+}
+
+// loadRequests decodes a list of requests, inserting the requests from `- include:` items
+// in place. The environments, setup, teardown and groups of files included this way are added to included.
+func (l *specLoader) loadRequests(nodes []yaml.Node, filename string, templates map[string]*yaml.Node, included *TestSet) ([]Request, error) {
+	requests := []Request{}
+	for i := range nodes {
+		node := &nodes[i]
+		if inc, ok := includeTarget(node); ok {
+			s, err := l.loadSpecFile(filepath.Join(filepath.Dir(filename), inc), templates)
+			if err != nil {
+				return nil, err
+			}
+			mergeTestSet(included, TestSet{Environment: s.Environment, Environments: s.Environments, Setup: s.Setup, Teardown: s.Teardown, Groups: s.Groups})
+			requests = append(requests, s.Requests...)
+			continue
+		}
+
+		node, err := resolveExtends(node, templates, []string{})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+
+		r := Request{}
+		if err := node.Decode(&r); err != nil {
+			return nil, fmt.Errorf("Unmarshal %s: %v", filename, err)
+		}
+		resolveRequestPaths(&r, filename)
+
+		// data driven requests are expanded into one request per data row
+		expanded, err := expandData(r)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+		for _, r := range expanded {
+			if r.Expect.Snapshot != nil {
+				r.Expect.Snapshot.path = snapshotPath(filename, r.Name)
+			}
+			requests = append(requests, r)
+		}
+	}
+	return requests, nil
+}
+
+// mergeTestSet adds the requests from an included test set and merges its environments.
+// The included set's teardown requests are added before the existing ones, so that
+// teardown runs in the reverse order of setup.
+func mergeTestSet(set *TestSet, included TestSet) {
+	set.Environment.merge(included.Environment)
+	for name, env := range included.Environments {
+		merged := set.Environments[name]
+		merged.merge(env)
+		set.Environments[name] = merged
+	}
+	set.Requests = append(set.Requests, included.Requests...)
+	set.Setup = append(set.Setup, included.Setup...)
+	set.Teardown = append(append([]Request{}, included.Teardown...), set.Teardown...)
+	set.Groups = append(set.Groups, included.Groups...)
+}
+
+// resolveRequestPaths makes fixture and data files relative to the test spec file
+// where the request was defined.
+func resolveRequestPaths(r *Request, filename string) {
+	if r.Expect.Body != nil && r.Expect.Body.File != "" && !filepath.IsAbs(r.Expect.Body.File) {
+		r.Expect.Body.File = filepath.Join(filepath.Dir(filename), r.Expect.Body.File)
+	}
+	if r.Data != nil && r.Data.File != "" && !filepath.IsAbs(r.Data.File) {
+		r.Data.File = filepath.Join(filepath.Dir(filename), r.Data.File)
+	}
+}
+
+// includeTarget returns the file name if a requests list item is an include (`- include: file.yaml`)
+func includeTarget(node *yaml.Node) (string, bool) {
+	if value := mappingValue(node, "include"); value != nil {
+		return value.Value, true
+	}
+	return "", false
+}
+
+// resolveExtends returns a request node merged over the template it extends (if any).
+// Templates can extend other templates.
+func resolveExtends(node *yaml.Node, templates map[string]*yaml.Node, seen []string) (*yaml.Node, error) {
+	extends := mappingValue(node, "extends")
+	if extends == nil {
+		return node, nil
+	}
+
+	name := extends.Value
+	for _, s := range seen {
+		if s == name {
+			return nil, fmt.Errorf("template cycle: %s -> %s", strings.Join(seen, " -> "), name)
+		}
+	}
+	template, ok := templates[name]
+	if !ok {
+		return nil, fmt.Errorf("request template %s not found (line %v)", name, extends.Line)
+	}
+
+	base, err := resolveExtends(template, templates, append(seen, name))
+	if err != nil {
+		return nil, err
+	}
+	return mergeNodes(base, withoutKey(node, "extends")), nil
+}
+
+// mergeNodes deep merges two yaml mappings. Values from override replace values from base,
+// except for mappings, which are merged. The input nodes are not modified.
+func mergeNodes(base *yaml.Node, override *yaml.Node) *yaml.Node {
+	if base.Kind != yaml.MappingNode || override.Kind != yaml.MappingNode {
+		return override
+	}
+
+	merged := *base
+	merged.Content = append([]*yaml.Node{}, base.Content...)
+
+	for i := 0; i+1 < len(override.Content); i += 2 {
+		key, value := override.Content[i], override.Content[i+1]
+		replaced := false
+		for j := 0; j+1 < len(merged.Content); j += 2 {
+			if merged.Content[j].Value == key.Value {
+				merged.Content[j+1] = mergeNodes(merged.Content[j+1], value)
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			merged.Content = append(merged.Content, key, value)
+		}
+	}
+	return &merged
+}
+
+// mappingValue returns the value for a key in a yaml mapping node, or nil if not found.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// withoutKey returns a copy of a mapping node with a key removed.
+func withoutKey(node *yaml.Node, key string) *yaml.Node {
+	out := *node
+	out.Content = []*yaml.Node{}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value != key {
+			out.Content = append(out.Content, node.Content[i], node.Content[i+1])
+		}
+	}
+	return &out
+}
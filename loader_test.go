@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIncludeAndExtends(t *testing.T) {
+	set, err := readTestDefinition("test/include/main.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// requests from top level includes come first, and list item includes are inserted in place
+	names := []string{}
+	for _, r := range set.Requests {
+		names = append(names, r.Name)
+	}
+	expectedNames := "Health check,Log in,List todos,Get todo"
+	if strings.Join(names, ",") != expectedNames {
+		t.Errorf("Expected '%v', received '%v'", expectedNames, strings.Join(names, ","))
+	}
+
+	// the including file's environment takes precedence
+	expectedVars := map[string]interface{}{
+		"host":     "http://localhost:8000",
+		"user":     "alice",
+		"auth_url": "http://localhost:8000/login",
+	}
+	for k, v := range expectedVars {
+		if set.Environment.Vars[k] != v {
+			t.Errorf("%s: expected '%v', received '%v'", k, v, set.Environment.Vars[k])
+		}
+	}
+	if set.Environment.Headers["Accept"] != "application/json" {
+		t.Errorf("Expected '%v', received '%v'", "application/json", set.Environment.Headers["Accept"])
+	}
+
+	// requests extending a template are merged with it
+	get := set.Requests[3]
+	if get.Method != "get" || get.URL != "{{host}}/todos/1" {
+		t.Errorf("unexpected request %s %s", get.Method, get.URL)
+	}
+	if get.Expect.MaxDuration.Duration != time.Second || get.Expect.Status.check(200) != nil {
+		t.Errorf("expect block was not merged with the template: %+v", get.Expect)
+	}
+	if get.Expect.Values["id"] != 1 {
+		t.Errorf("Expected '%v', received '%v'", 1, get.Expect.Values["id"])
+	}
+}
+
+func TestIncludeCycle(t *testing.T) {
+	_, err := readTestDefinition("test/include/cycle-a.yaml")
+	if err == nil || !strings.Contains(err.Error(), "include cycle") {
+		t.Errorf("expected an include cycle error, received %v", err)
+	}
+}
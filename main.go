@@ -4,13 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
-	"regexp"
 	"strings"
 	"time"
 
@@ -20,18 +18,38 @@ import (
 
 // TestSet is a set of requests and assertions
 type TestSet struct {
-	Requests    []Request   `yaml:"requests"`
+	Requests []Request `yaml:"requests"`
+	// Setup requests run before Requests (e.g. to create fixtures), and Teardown
+	// requests run after them, even if requests failed.
+	Setup    []Request `yaml:"setup"`
+	Teardown []Request `yaml:"teardown"`
+	// Groups are named sets of requests that run after Requests
+	Groups      []Group     `yaml:"groups"`
 	Environment Environment `yaml:"environment"`
+	// Environments are named profiles (e.g. staging, prod) layered over
+	// Environment when selected with the --profile flag.
+	Environments map[string]Environment `yaml:"environments"`
 }
 
 // Environment stores defaults to use with each request.
-// Vars holds variables to be inserted (using the text/template package)
+// Vars holds variables to be inserted (using template tags, see template.go)
 // into request specs (e.g. http://{{hostname}}/api/posts). Vars may be updated
 // after a request if the input request spec has a "set" block.
 // Headers can contain variables.
 type Environment struct {
 	Vars    map[string]interface{} `yaml:"vars"`
 	Headers map[string]string      `yaml:"headers"`
+	// MaxDuration is the default maximum response time for every request
+	MaxDuration Duration `yaml:"maxDuration"`
+	// Secrets are vars whose values are redacted from all output
+	Secrets []Secret `yaml:"secrets"`
+	// Auth adds credentials to every request (see auth.go)
+	Auth *Auth `yaml:"auth"`
+	// TLS holds settings for CA certificates, client certificates and TLS verification
+	TLS *TLSConfig `yaml:"tls"`
+	// fixed holds the names of vars from env files, the command line and secrets, and of
+	// vars set by requests. Group vars don't override them.
+	fixed map[string]bool
 }
 
 // Request is a request made against a URL to test the response.
@@ -44,93 +62,171 @@ type Request struct {
 	Body        map[string]interface{} `yaml:"body"`
 	Expect      Expect                 `yaml:"expect"`
 	SetVars     []UserVar              `yaml:"set"`
+	// Vars are variables that only apply to this request, overriding environment vars
+	Vars map[string]interface{} `yaml:"vars"`
+	// Data and Matrix run the request once for each row of variables (see data.go)
+	Data   *DataSource              `yaml:"data"`
+	Matrix map[string][]interface{} `yaml:"matrix"`
+	// Skip skips the request, with an optional reason
+	Skip Skip `yaml:"skip"`
+	// Only runs only the requests marked with `only: true`
+	Only bool `yaml:"only"`
+	// When is a condition (e.g. "{{feature_x}} == true") evaluated before the request runs.
+	// The request is skipped if the condition is false.
+	When string `yaml:"when"`
+	// Tags are labels used to select requests with --tags (e.g. smoke, slow)
+	Tags stringList `yaml:"tags"`
+	// DependsOn lists the names of earlier requests that must pass before this request runs
+	DependsOn stringList `yaml:"depends_on"`
+	// Critical stops the test run if the request fails
+	Critical bool `yaml:"critical"`
+	// Auth adds credentials to the request, replacing the environment's auth (see auth.go)
+	Auth *Auth `yaml:"auth"`
+	// Paginate repeats the request for each page of a paginated endpoint (see paginate.go)
+	Paginate *Paginate `yaml:"paginate"`
+
+	// baseName is the name of the request that a data driven request was expanded from
+	baseName string
+	// group is the full name of the group the request is in
+	group string
 }
 
 // Expect is a test assertion.  The values provided will be checked against the request's response.
 type Expect struct {
-	// Status is the response status code, e.g. 200 for "OK", 404 for "Not Found"
-	Status int                    `yaml:"status"`
+	// Status is the response status code, e.g. 200 for "OK", 404 for "Not Found".
+	// Also accepts classes (2xx), lists ([200, 204]) and assertion rules. Defaults to any 2xx status.
+	Status StatusExpectation      `yaml:"status"`
 	Values map[string]interface{} `yaml:"values"`
 	Strict bool                   `yaml:"strict"`
+	// Body compares the entire response body against an expected document
+	Body *BodyExpectation `yaml:"body"`
+	// Snapshot compares the response against a stored copy of an earlier response
+	Snapshot *Snapshot `yaml:"snapshot"`
+	// MaxDuration is the maximum response time (e.g. 250ms). Overrides the environment default.
+	MaxDuration Duration `yaml:"maxDuration"`
+	// Text holds rules checked against the raw response body (for any content type)
+	Text *TextExpectation `yaml:"text"`
+	// XML holds XPath selectors and expected values for XML responses
+	XML map[string]interface{} `yaml:"xml"`
+	// TLS holds rules checked against the server's certificate and TLS connection
+	TLS *TLSExpectation `yaml:"tls"`
 }
 
 // UserVar holds a value (string) and a type. The key/value pair will be copied to the
 // Environment.Vars map. This allows users to store values from one request to the next
 // (e.g. a token received after a login request, or the ID or other response value from
 // a created resource)
+// The value comes from one source: a JSON body selector (Key), a response header,
+// a cookie, the status code or the response duration (in milliseconds). Regex can be used
+// to capture part of the value (or of the raw body, if there is no other source).
+// Default is used when the source is missing instead of failing the request.
 type UserVar struct {
-	Key  string `yaml:"from"`
-	Name string `yaml:"var"`
+	Key      string      `yaml:"from"`
+	Name     string      `yaml:"var"`
+	Header   string      `yaml:"header"`
+	Cookie   string      `yaml:"cookie"`
+	Status   bool        `yaml:"status"`
+	Duration bool        `yaml:"duration"`
+	Regex    string      `yaml:"regex"`
+	Default  interface{} `yaml:"default"`
+	// Secret redacts the value from all output (e.g. for tokens)
+	Secret bool `yaml:"secret"`
 }
 
-// readTestDefinition reads a yaml file of test requests
-// and returns a TestSet.  If an error occurs while reading the file
-// or unmarshaling yaml, an empty test set and an error will be returned.
-func readTestDefinition(filename string) (TestSet, error) {
-	set := TestSet{}
+// Duration is a time.Duration that can be read from a yaml string like "250ms" or "2s"
+type Duration struct {
+	time.Duration
+}
 
-	// Read in a yaml file containing test specs
-	file, err := ioutil.ReadFile(filename)
-	if err != nil {
-		return TestSet{}, fmt.Errorf("File open error %v ", err)
+// UnmarshalYAML parses a duration string using time.ParseDuration
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return err
 	}
-
-	// process template tags.  a period will be pre-pended to the argument: {{ myVar }} becomes {{ .myVar }}
-	// so that the text/template package can replace them with variables.
-	r, err := regexp.Compile(`{{\s*(\w+)\s*}}`)
+	duration, err := time.ParseDuration(s)
 	if err != nil {
-		return TestSet{}, errors.New("error processing {{ template }} tags. Please double check input file")
+		return fmt.Errorf("invalid duration %s. Use a duration like 250ms or 2s", s)
 	}
-	file = r.ReplaceAll(file, []byte(`{{.$1}}`))
+	d.Duration = duration
+	return nil
+}
 
-	// convert yaml to structs.
-	// the output should be a single TestSet with nested Request structs.
-	err = yaml.Unmarshal(file, &set)
-	if err != nil {
-		return TestSet{}, fmt.Errorf("Unmarshal: %v", err)
+// RunOptions holds the command line options that control how requests are run.
+type RunOptions struct {
+	// TestNames are names or patterns of tests to run. All other tests are left out.
+	TestNames []string
+	// Tags selects requests with any of the tags. Tags starting with ! leave requests out.
+	Tags            []string
+	Verbose         bool
+	Monitor         bool
+	UpdateSnapshots bool
+	// FailFast stops the test run after the first failed request
+	FailFast bool
+	// MaxFailures stops the test run after this many failed requests (0 means no limit)
+	MaxFailures int
+	// TLS holds TLS settings from the command line, which override the test spec's settings
+	TLS TLSConfig
+}
+
+// tlsConfig returns TLS settings from the test spec with the command line settings merged over them.
+func (opts RunOptions) tlsConfig(spec *TLSConfig) *TLSConfig {
+	if opts.TLS == (TLSConfig{}) {
+		return spec
 	}
+	tlsConfig := TLSConfig{}
+	tlsConfig.merge(spec)
+	tlsConfig.merge(&opts.TLS)
+	return &tlsConfig
+}
 
-	return set, nil
+// RunSummary holds the results of a test run
+type RunSummary struct {
+	// Total is the number of requests that were run, or that failed before they could run
+	// (e.g. because of a missing dependency)
+	Total   int
+	Failed  int
+	Skipped int
+	// NotRun is the number of requests left after the run was stopped early
+	NotRun int
 }
 
-// runRequests accepts a set of Request objects and calls the request() function
-// for each one. Since requests are expected to fail often, errors are not passed
-// up to the calling function, but instead reported to output, tallied
-// and the total request & error counts returned at the end of the run.
-func runRequests(requests []Request, env Environment, testname string, verbose bool, monitor bool) (int, int) {
-	failCount := 0
-	currentRequest := 0
-
-	// iterate through requests and keep track of test fails
-	for _, r := range requests {
-		// if a test name was provided, skip this test request if it does not match.
-		if testname != "" && testname != r.Name {
-			continue
-		}
-		method := strings.ToUpper(r.Method)
-
-		currentRequest++
-
-		// make the request.
-		// the hostname/path is parsed immediately so it's available for both
-		// error handling and the "happy path"
-		rawURL, duration, err := request(r, currentRequest, env, verbose)
-		hostname, path := processURL(rawURL)
-		if err != nil {
-			// actions to take for unsuccessful requests
-			log.Println("  ", err)
-			failCount++
-			if monitor {
-				recordError(r.Name, hostname, path, method)
-			}
-		}
+// add adds the counts from another summary
+func (s *RunSummary) add(other RunSummary) {
+	s.Total += other.Total
+	s.Failed += other.Failed
+	s.Skipped += other.Skipped
+	s.NotRun += other.NotRun
+}
 
-		durationSeconds := duration.Seconds()
-		recordRequest(r.Name, hostname, path, method)
-		recordDuration(r.Name, hostname, path, method, durationSeconds)
+// String returns the request counts, e.g. "(10 requests, 1 failed, 2 skipped)"
+func (s RunSummary) String() string {
+	counts := fmt.Sprintf("%v requests", s.Total)
+	if s.Failed > 0 {
+		counts += fmt.Sprintf(", %v failed", s.Failed)
+	}
+	if s.Skipped > 0 {
+		counts += fmt.Sprintf(", %v skipped", s.Skipped)
+	}
+	if s.NotRun > 0 {
+		counts += fmt.Sprintf(", %v not run", s.NotRun)
+	}
+	return "(" + counts + ")"
+}
 
+// readTestDefinition reads a yaml file of test requests (and any files it includes)
+// and returns a TestSet.  If an error occurs while reading the file
+// or unmarshaling yaml, an empty test set and an error will be returned.
+func readTestDefinition(filename string) (TestSet, error) {
+	l := &specLoader{}
+	set, err := l.loadSpecFile(filename, nil)
+	if err != nil {
+		return TestSet{}, err
+	}
+	if err := checkSnapshotPaths(set); err != nil {
+		return TestSet{}, err
 	}
-	return currentRequest, failCount
+	return set, nil
 }
 
 func processURL(rawURL string) (string, string) {
@@ -154,27 +250,48 @@ func (env Environment) processEnvVars(userVars []string) error {
 			return errors.New("Error processing env vars.  Usage example: -e myvar=$MYVAR -e anothervar=$MYVAR2")
 		}
 		env.Vars[pair[0]] = pair[1]
+		env.fix(pair[0])
 	}
 	return nil
 }
 
 func main() {
 	var filename string
-	var testname string
 	var userVars []string
-	var verbose bool
-	var monitor bool
+	var envFiles []string
+	var userSecrets []string
+	var profile string
+	var insecure bool
 	var listenPort int
 	var delay int
+	opts := RunOptions{}
 	flag.StringVarP(&filename, "file", "f", "", "yaml file containing a list of test requests")
-	flag.StringVarP(&testname, "test", "t", "", "the name of a single test to run (use quotes if name has spaces)")
-	flag.BoolVarP(&verbose, "verbose", "v", false, "verbose mode: print response body")
-	flag.BoolVarP(&monitor, "monitor", "m", false, "turn on monitor mode to continually run checks")
+	flag.StringArrayVarP(&opts.TestNames, "test", "t", []string{}, "the name of a test to run (use quotes if name has spaces). Accepts globs (Get*) and regexes (/^Get/), and can be repeated")
+	flag.StringSliceVar(&opts.Tags, "tags", []string{}, "only run requests with these tags. Use !tag to leave out requests with a tag, e.g. --tags smoke,!slow")
+	flag.BoolVarP(&opts.Verbose, "verbose", "v", false, "verbose mode: print response body")
+	flag.BoolVarP(&opts.Monitor, "monitor", "m", false, "turn on monitor mode to continually run checks")
+	flag.BoolVar(&opts.FailFast, "fail-fast", false, "stop after the first failed request")
+	flag.IntVar(&opts.MaxFailures, "max-failures", 0, "stop after this many failed requests")
+	flag.BoolVar(&opts.UpdateSnapshots, "update-snapshots", false, "overwrite stored response snapshots with the responses received")
 	flag.IntVarP(&listenPort, "port", "p", 2112, "port to start listener on (used with --monitor)")
 	flag.StringSliceVarP(&userVars, "env", "e", []string{}, "variables to add to the test environment e.g. myvar=test123")
+	flag.StringArrayVarP(&userSecrets, "secret", "s", []string{}, "secret variables to add to the test environment, redacted from all output e.g. token=$TOKEN")
+	flag.StringSliceVar(&envFiles, "env-file", []string{}, "a .env file with variables to add to the test environment")
+	flag.StringVar(&profile, "profile", "", "the name of an environment profile from the test spec's environments block (e.g. staging)")
+	flag.StringVar(&opts.TLS.CA, "cacert", "", "a PEM file of CA certificates to trust when verifying servers")
+	flag.StringVar(&opts.TLS.Cert, "cert", "", "a PEM file with a client certificate (used with --key)")
+	flag.StringVar(&opts.TLS.Key, "key", "", "a PEM file with the client certificate's private key")
+	flag.StringVar(&opts.TLS.ServerName, "tls-server-name", "", "the host name used to verify server certificates")
+	flag.StringVar(&opts.TLS.MinVersion, "tls-min-version", "", "the minimum TLS version (1.0, 1.1, 1.2 or 1.3)")
+	flag.BoolVarP(&insecure, "insecure", "k", false, "don't verify server certificates")
 	flag.IntVarP(&delay, "delay", "d", 300, "delay (in seconds) between monitoring runs (used with --monitor). Default 300")
 	flag.Parse()
 
+	useColor = colorEnabled(os.Stderr)
+
+	// secret values are redacted from everything written to the log
+	log.SetOutput(&redactingWriter{w: os.Stderr})
+
 	// user can enter filename as the first argument, or with the -f flag
 	if flag.NArg() > 0 && filename == "" {
 		filename = flag.Args()[0]
@@ -184,32 +301,50 @@ func main() {
 		log.Fatal("No file specified. Usage:  apitest -f test.yaml")
 	}
 
+	if flag.CommandLine.Changed("insecure") {
+		opts.TLS.InsecureSkipVerify = &insecure
+	}
+
+	if err := opts.checkFilters(); err != nil {
+		log.Fatal(err)
+	}
+
 	// read in test definitions from a provided yaml file
 	set, err := readTestDefinition(filename)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// set variables in the test environment to values provided with the -e CLI flag.
-	// these are starting values; it is possible to update them during a test run.
-	err = set.Environment.processEnvVars(userVars)
+	// set up the test environment from the spec, the selected profile, env files and
+	// the -e and -s CLI flags. these are starting values; it is possible to update them during a test run.
+	set.Environment, err = buildEnvironment(set, profile, envFiles, userVars, userSecrets)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	if !monitor {
+	// TLS settings from the command line override the test spec (groups are merged when they run)
+	set.Environment.TLS = opts.tlsConfig(set.Environment.TLS)
+	if _, err := set.Environment.TLS.transport(); err != nil {
+		log.Fatal(err)
+	}
+
+	if !opts.Monitor {
 		// run the set of tests and exit the program.
 		// additional output will be provided by each request.
 		// TODO: handle multiple test suites
 		log.Println("Running tests...")
-		totalRequests, failCount := runRequests(set.Requests, set.Environment, testname, verbose, monitor)
+		summary, teardown := runTestSet(set, opts)
 
-		log.Println("Total requests:", totalRequests)
+		log.Println("Total requests:", summary.Total)
 
-		if failCount > 0 {
-			log.Fatalf("FAIL  %s (%v requests, %v failed)", filename, totalRequests, failCount)
+		// teardown failures are reported, but don't change the test result
+		if teardown.Failed > 0 {
+			log.Printf("TEARDOWN FAIL  %s %s", filename, teardown)
+		}
+		if summary.Failed > 0 {
+			log.Fatalf("FAIL  %s %s", filename, summary)
 		}
-		log.Printf("PASSED  %s (%v requests)", filename, totalRequests)
+		log.Printf("PASSED  %s %s", filename, summary)
 		os.Exit(0)
 	}
 
@@ -232,7 +367,7 @@ func main() {
 	log.Println("Listening on port", listenPort)
 
 	// run monitoring loop
-	go runMonitor(set.Requests, set.Environment, testname, verbose, filename, delay)
+	go runMonitor(set, opts, filename, delay)
 
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt)
@@ -246,16 +381,20 @@ func main() {
 
 // runMonitor is used for monitoring mode and runs a continuous loop, checking the same
 // test suite over and over for the purpose of collecting metrics and monitoring endpoints.
-func runMonitor(requests []Request, env Environment, testname string, verbose bool, filename string, delay int) {
+func runMonitor(set TestSet, opts RunOptions, filename string, delay int) {
 	for {
-		totalRequests, failCount := runRequests(requests, env, testname, verbose, true)
+		summary, teardown := runTestSet(set, opts)
 
-		log.Println("Total requests:", totalRequests)
+		log.Println("Total requests:", summary.Total)
+
+		if teardown.Failed > 0 {
+			log.Printf("TEARDOWN FAIL  %s %s", filename, teardown)
+		}
 
-		if failCount > 0 {
-			log.Printf("FAIL  %s (%v requests, %v failed)", filename, totalRequests, failCount)
+		if summary.Failed > 0 {
+			log.Printf("FAIL  %s %s", filename, summary)
 		} else {
-			log.Printf("PASSED  %s (%v requests)", filename, totalRequests)
+			log.Printf("PASSED  %s %s", filename, summary)
 		}
 
 		time.Sleep(time.Duration(delay) * time.Second)
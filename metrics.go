@@ -25,6 +25,30 @@ var (
 			Help:      "The total number of requests that had at least one assertion error",
 		},
 		[]string{"name", "hostname", "path", "method"})
+	requestAuthErrors = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "apitest",
+			Subsystem: "requests",
+			Name:      "auth_errors_total",
+			Help:      "The total number of requests that failed because credentials could not be obtained (e.g. a token request failed)",
+		},
+		[]string{"name", "hostname", "path", "method"})
+	requestsSlow = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "apitest",
+			Subsystem: "requests",
+			Name:      "slow_total",
+			Help:      "The total number of requests that took longer than their maximum duration",
+		},
+		[]string{"name", "hostname", "path", "method"})
+	certExpirySeconds = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "apitest",
+			Subsystem: "tls",
+			Name:      "cert_expiry_seconds",
+			Help:      "The number of seconds until the first certificate in the server's certificate chain expires",
+		},
+		[]string{"hostname"})
 	requestDurations = promauto.NewSummaryVec(
 		prometheus.SummaryOpts{
 			Namespace: "apitest",
@@ -42,6 +66,21 @@ func recordError(name string, hostname string, path string, method string) {
 	requestErrors.WithLabelValues(name, hostname, path, method).Inc()
 }
 
+// recordAuthError records a request that failed because of an auth error.
+func recordAuthError(name string, hostname string, path string, method string) {
+	requestAuthErrors.WithLabelValues(name, hostname, path, method).Inc()
+}
+
+// recordSlowRequest records a request that exceeded its maximum duration.
+func recordSlowRequest(name string, hostname string, path string, method string) {
+	requestsSlow.WithLabelValues(name, hostname, path, method).Inc()
+}
+
+// recordCertExpiry records the time until a server's certificates expire.
+func recordCertExpiry(hostname string, seconds float64) {
+	certExpirySeconds.WithLabelValues(hostname).Set(seconds)
+}
+
 // recordRequest records a request made.
 func recordRequest(name string, hostname string, path string, method string) {
 	requestsProcessed.WithLabelValues(name, hostname, path, method).Inc()
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenExpiryMargin is how long before its expiry a token is refreshed
+const tokenExpiryMargin = 30 * time.Second
+
+// OAuth2 gets access tokens from an OAuth2 token endpoint using the client credentials
+// grant (the default) or the password grant. Tokens are cached for the life of the process,
+// so in monitor mode a token is reused across runs until it expires. Expired tokens are
+// renewed with their refresh token if they have one, otherwise a new token is requested.
+type OAuth2 struct {
+	TokenURL string `yaml:"tokenUrl"`
+	// Grant is client_credentials or password
+	Grant        string     `yaml:"grant"`
+	ClientID     string     `yaml:"clientId"`
+	ClientSecret string     `yaml:"clientSecret"`
+	Username     string     `yaml:"username"`
+	Password     string     `yaml:"password"`
+	Scopes       stringList `yaml:"scopes"`
+	// Params are extra form values sent to the token endpoint (e.g. audience)
+	Params map[string]string `yaml:"params"`
+	// ClientAuth is how the client id and secret are sent: "header" (HTTP basic auth,
+	// the default) or "body" (as form values)
+	ClientAuth string `yaml:"clientAuth"`
+}
+
+// oauth2Token is an access token from a token endpoint
+type oauth2Token struct {
+	AccessToken  string      `json:"access_token"`
+	TokenType    string      `json:"token_type"`
+	RefreshToken string      `json:"refresh_token"`
+	ExpiresIn    json.Number `json:"expires_in"`
+
+	expires time.Time
+}
+
+// header returns the Authorization header value for the token
+func (t *oauth2Token) header() string {
+	tokenType := t.TokenType
+	if tokenType == "" || strings.EqualFold(tokenType, "bearer") {
+		tokenType = "Bearer"
+	}
+	return tokenType + " " + t.AccessToken
+}
+
+// valid returns true if the token has not expired. Tokens without an expiry are always valid.
+func (t *oauth2Token) valid() bool {
+	return t.expires.IsZero() || time.Now().Add(tokenExpiryMargin).Before(t.expires)
+}
+
+// tokenCache holds tokens for each OAuth2 configuration used during the life of the process
+type tokenCache struct {
+	mu     sync.Mutex
+	tokens map[string]*oauth2Token
+}
+
+var oauth2Tokens = &tokenCache{tokens: make(map[string]*oauth2Token)}
+
+// tokenTimeout is the time limit for token requests
+const tokenTimeout = 30 * time.Second
+
+// token returns a cached token, or gets a new one from the token endpoint.
+// Token requests use the given transport (see TLSConfig.otherHosts).
+func (o OAuth2) token(vars map[string]interface{}, transport http.RoundTripper) (*oauth2Token, error) {
+	o, err := o.render(vars)
+	if err != nil {
+		return nil, err
+	}
+	if o.TokenURL == "" {
+		return nil, errors.New("oauth2 tokenUrl is required")
+	}
+	if o.Grant == "" {
+		o.Grant = "client_credentials"
+	}
+	if o.Grant != "client_credentials" && o.Grant != "password" {
+		return nil, fmt.Errorf("unsupported oauth2 grant %s (use client_credentials or password)", o.Grant)
+	}
+	secrets.add(o.ClientSecret)
+	secrets.add(o.Password)
+
+	key := strings.Join([]string{o.TokenURL, o.Grant, o.ClientID, o.Username, strings.Join(o.Scopes, " ")}, "\n")
+
+	oauth2Tokens.mu.Lock()
+	defer oauth2Tokens.mu.Unlock()
+
+	cached := oauth2Tokens.tokens[key]
+	if cached != nil && cached.valid() {
+		return cached, nil
+	}
+
+	var token *oauth2Token
+	if cached != nil && cached.RefreshToken != "" {
+		token, err = o.requestToken(url.Values{"grant_type": {"refresh_token"}, "refresh_token": {cached.RefreshToken}}, transport)
+	}
+	if token == nil {
+		form := url.Values{"grant_type": {o.Grant}}
+		if o.Grant == "password" {
+			form.Set("username", o.Username)
+			form.Set("password", o.Password)
+		}
+		if len(o.Scopes) > 0 {
+			form.Set("scope", strings.Join(o.Scopes, " "))
+		}
+		for k, v := range o.Params {
+			form.Set(k, v)
+		}
+		token, err = o.requestToken(form, transport)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// a refreshed token may not include a new refresh token
+	if token.RefreshToken == "" && cached != nil {
+		token.RefreshToken = cached.RefreshToken
+	}
+	oauth2Tokens.tokens[key] = token
+	return token, nil
+}
+
+// requestToken posts a token request to the token endpoint.
+func (o OAuth2) requestToken(form url.Values, transport http.RoundTripper) (*oauth2Token, error) {
+	if o.ClientAuth == "body" {
+		form.Set("client_id", o.ClientID)
+		form.Set("client_secret", o.ClientSecret)
+	}
+
+	req, err := http.NewRequest("POST", o.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if o.ClientAuth != "body" && o.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(o.ClientID), url.QueryEscape(o.ClientSecret))
+	}
+
+	client := &http.Client{Timeout: tokenTimeout, Transport: transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request to %s failed: %v", o.TokenURL, err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not read token response: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		tokenErr := struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}{}
+		if json.Unmarshal(body, &tokenErr) == nil && tokenErr.Error != "" {
+			return nil, fmt.Errorf("token request to %s failed with status %v: %s %s", o.TokenURL, resp.StatusCode, tokenErr.Error, tokenErr.Description)
+		}
+		return nil, fmt.Errorf("token request to %s failed with status %v", o.TokenURL, resp.StatusCode)
+	}
+
+	token := &oauth2Token{}
+	if err := json.Unmarshal(body, token); err != nil {
+		return nil, fmt.Errorf("could not decode token response: %v", err)
+	}
+	if token.AccessToken == "" {
+		return nil, errors.New("token response did not include an access_token")
+	}
+	secrets.add(token.AccessToken)
+	secrets.add(token.RefreshToken)
+
+	if seconds, err := token.ExpiresIn.Int64(); err == nil && seconds > 0 {
+		token.expires = time.Now().Add(time.Duration(seconds) * time.Second)
+	}
+	return token, nil
+}
+
+// render replaces template tags in the OAuth2 settings.
+func (o OAuth2) render(vars map[string]interface{}) (OAuth2, error) {
+	fields := []*string{&o.TokenURL, &o.Grant, &o.ClientID, &o.ClientSecret, &o.Username, &o.Password}
+	for _, f := range fields {
+		value, err := renderTemplate("auth", *f, vars)
+		if err != nil {
+			return o, err
+		}
+		*f = value
+	}
+
+	params := make(map[string]string, len(o.Params))
+	for k, v := range o.Params {
+		value, err := renderTemplate("auth", v, vars)
+		if err != nil {
+			return o, err
+		}
+		params[k] = value
+	}
+	o.Params = params
+	return o, nil
+}
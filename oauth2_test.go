@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOAuth2Token(t *testing.T) {
+	resetSecrets()
+	defer resetSecrets()
+
+	grants := []string{}
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		req.ParseForm()
+		grant := req.Form.Get("grant_type")
+		grants = append(grants, grant)
+
+		id, secret, _ := req.BasicAuth()
+		if id != "client" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+		if grant == "password" && req.Form.Get("password") != "hunter2" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": "bad password"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  fmt.Sprintf("token%v", len(grants)),
+			"token_type":    "bearer",
+			"expires_in":    3600,
+			"refresh_token": "refresh",
+		})
+	}))
+	defer tokenServer.Close()
+
+	vars := map[string]interface{}{"token_url": tokenServer.URL, "secret": "s3cret"}
+	o := OAuth2{TokenURL: "{{token_url}}", ClientID: "client", ClientSecret: "{{secret}}", Scopes: stringList{"read"}}
+
+	token, err := o.token(vars, http.DefaultTransport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.header() != "Bearer token1" {
+		t.Errorf("unexpected header %s", token.header())
+	}
+
+	// tokens are cached
+	if token, _ = o.token(vars, http.DefaultTransport); token.AccessToken != "token1" || len(grants) != 1 {
+		t.Errorf("expected a cached token, received %s after %v token requests", token.AccessToken, len(grants))
+	}
+
+	// expired tokens are refreshed
+	token.expires = time.Now()
+	if token, _ = o.token(vars, http.DefaultTransport); token.AccessToken != "token2" || grants[1] != "refresh_token" {
+		t.Errorf("expected a refreshed token, received %s with grants %v", token.AccessToken, grants)
+	}
+
+	password := OAuth2{TokenURL: tokenServer.URL, Grant: "password", ClientID: "client", ClientSecret: "s3cret", Username: "alice", Password: "wrong"}
+	if _, err := password.token(vars, http.DefaultTransport); err == nil || err.Error() != fmt.Sprintf("token request to %s failed with status 400: invalid_grant bad password", tokenServer.URL) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestOAuth2AuthError(t *testing.T) {
+	resetSecrets()
+	defer resetSecrets()
+
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer tokenServer.Close()
+
+	api := httptest.NewServer(http.HandlerFunc(basicRequestHandler))
+	defer api.Close()
+
+	env := Environment{
+		Vars: map[string]interface{}{"host": api.URL},
+		Auth: &Auth{OAuth2: &OAuth2{TokenURL: tokenServer.URL, ClientID: "client", ClientSecret: "other"}},
+	}
+	r := Request{Name: "Get todo", URL: "{{host}}/todos/1", Method: "get"}
+	_, _, err := request(r, 1, env, RunOptions{})
+	if !errors.As(err, &authError{}) {
+		t.Errorf("expected an auth error, received %v", err)
+	}
+}
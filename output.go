@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+)
+
+// ANSI color codes used to highlight differences in test output
+const (
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+	colorReset  = "\033[0m"
+)
+
+// useColor controls whether output is colorized. It is enabled in main()
+// when the log output is a terminal and the NO_COLOR env variable is not set.
+var useColor = false
+
+// colorEnabled returns true if the file is a terminal and the user has not
+// opted out of colors with the NO_COLOR environment variable.
+func colorEnabled(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// colorize wraps a string in an ANSI color code if color output is enabled.
+func colorize(color string, s string) string {
+	if !useColor {
+		return s
+	}
+	return color + s + colorReset
+}
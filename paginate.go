@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultMaxPages is the maximum number of pages requested when a
+// paginate block doesn't set maxPages.
+const defaultMaxPages = 100
+
+// Paginate repeats a request to walk through the pages of a paginated endpoint. Each page
+// is checked against the request's expect block. The next page's URL is found with a
+// selector for the JSON response body (Next), or a rel from the Link header (Link,
+// e.g. "next"). Without Next or Link, the same request is repeated with the page number
+// available as {{_page}}, e.g. `url: "{{host}}/users?page={{_page}}"`.
+//
+// Paging stops when there is no next page, when the Until condition is true (checked
+// after each page, see evalCondition) or after MaxPages pages. Without Next, Link or Until,
+// MaxPages is required.
+// If Collect is set, the items from each page (selected with Items, or the whole page
+// body) are added to a list stored in the variable Collect.
+type Paginate struct {
+	Next     string `yaml:"next"`
+	Link     string `yaml:"link"`
+	Until    string `yaml:"until"`
+	MaxPages int    `yaml:"maxPages"`
+	Items    string `yaml:"items"`
+	Collect  string `yaml:"collect"`
+}
+
+// UnmarshalYAML rejects paginate blocks that have no way to stop other than the default maxPages.
+func (p *Paginate) UnmarshalYAML(value *yaml.Node) error {
+	type paginate Paginate
+	raw := paginate{}
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+	if raw.Next == "" && raw.Link == "" && raw.Until == "" && raw.MaxPages <= 0 {
+		return fmt.Errorf("line %v: paginate needs next, link or until, or maxPages to limit the number of pages", value.Line)
+	}
+	*p = Paginate(raw)
+	return nil
+}
+
+// vars used to capture pagination values from each page's response.
+// They are removed after each page.
+const (
+	nextPageVar  = "_next_page"
+	linkPageVar  = "_link_page"
+	pageItemsVar = "_page_items"
+)
+
+// linkHeaderPattern matches a link in a Link header, e.g. <https://example.com/?page=2>; rel="next"
+var linkHeaderPattern = regexp.MustCompile(`<([^>]*)>\s*;[^,]*rel="?([^",;]+)"?`)
+
+// paginate makes a request for each page and returns the URL of the first page, the
+// total duration of all pages, and an error if any page failed.
+func paginate(r Request, count int, env Environment, opts RunOptions) (string, time.Duration, error) {
+	p := r.Paginate
+	maxPages := p.MaxPages
+	if maxPages <= 0 {
+		maxPages = defaultMaxPages
+	}
+
+	firstURL := ""
+	total := time.Duration(0)
+	items := []interface{}{}
+	pageURL := ""
+
+	for page := 1; ; page++ {
+		pageRequest := r
+		pageRequest.Name = fmt.Sprintf("%s (page %v)", r.Name, page)
+		pageRequest.Vars = overlayVars(r.Vars, map[string]interface{}{"_page": page})
+		if pageURL != "" {
+			pageRequest.URL = pageURL
+		}
+		if r.Expect.Snapshot != nil {
+			pageRequest.Expect.Snapshot = r.Expect.Snapshot.page(page)
+		}
+
+		// pagination values are captured like vars from a `set:` block
+		pageRequest.SetVars = append([]UserVar{}, r.SetVars...)
+		if p.Next != "" {
+			pageRequest.SetVars = append(pageRequest.SetVars, UserVar{Key: p.Next, Name: nextPageVar, Default: ""})
+		}
+		if p.Link != "" {
+			pageRequest.SetVars = append(pageRequest.SetVars, UserVar{Header: "Link", Name: linkPageVar, Default: ""})
+		}
+		if p.Collect != "" {
+			selector := p.Items
+			if selector == "" {
+				selector = "."
+			}
+			pageRequest.SetVars = append(pageRequest.SetVars, UserVar{Key: selector, Name: pageItemsVar, Default: nil})
+		}
+
+		rawURL, duration, err := request(pageRequest, count, env, opts)
+		total += duration
+		if page == 1 {
+			firstURL = rawURL
+		}
+
+		next := templateString(env.Vars[nextPageVar])
+		link := linkHeaderURL(templateString(env.Vars[linkPageVar]), p.Link)
+		pageItems := env.Vars[pageItemsVar]
+		delete(env.Vars, nextPageVar)
+		delete(env.Vars, linkPageVar)
+		delete(env.Vars, pageItemsVar)
+
+		if err != nil {
+			return firstURL, total, fmt.Errorf("page %v: %w", page, err)
+		}
+
+		if p.Collect != "" {
+			if list, ok := pageItems.([]interface{}); ok {
+				items = append(items, list...)
+			} else if pageItems != nil {
+				items = append(items, pageItems)
+			}
+			env.Vars[p.Collect] = items
+			env.fix(p.Collect)
+		}
+
+		if p.Until != "" {
+			done, err := evalCondition(p.Until, pageRequest.vars(env))
+			if err != nil {
+				return firstURL, total, fmt.Errorf("error in until condition %s: %v", p.Until, err)
+			}
+			if done {
+				return firstURL, total, nil
+			}
+		}
+
+		if p.Next != "" || p.Link != "" {
+			if link != "" {
+				next = link
+			}
+			if next == "" {
+				return firstURL, total, nil
+			}
+			nextURL, err := resolvePageURL(rawURL, next)
+			if err != nil {
+				return firstURL, total, fmt.Errorf("page %v: invalid next page URL %s: %v", page, next, err)
+			}
+			pageURL = nextURL
+		}
+
+		if page >= maxPages {
+			if p.Next != "" || p.Link != "" || p.Until != "" {
+				log.Printf("  stopped after %v pages (maxPages)", page)
+			}
+			return firstURL, total, nil
+		}
+	}
+}
+
+// linkHeaderURL returns the URL with the rel from a Link header, or "" if there isn't one
+func linkHeaderURL(header string, rel string) string {
+	if header == "" || rel == "" {
+		return ""
+	}
+	for _, m := range linkHeaderPattern.FindAllStringSubmatch(header, -1) {
+		if m[2] == rel {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+// resolvePageURL resolves a next page link, which may be relative, against the current page's URL
+func resolvePageURL(current string, next string) (string, error) {
+	base, err := url.Parse(current)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(next)
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(ref).String(), nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// pagedHandler serves 3 pages of users, with a next link in the body and the Link header
+func pagedHandler(w http.ResponseWriter, req *http.Request) {
+	page, _ := strconv.Atoi(req.URL.Query().Get("page"))
+	if page == 0 {
+		page = 1
+	}
+	resp := map[string]interface{}{
+		"users": []interface{}{fmt.Sprintf("user%v-a", page), fmt.Sprintf("user%v-b", page)},
+		"next":  nil,
+	}
+	if page < 3 {
+		resp["next"] = fmt.Sprintf("/users?page=%v", page+1)
+		w.Header().Set("Link", fmt.Sprintf(`<http://%s/users?page=%v>; rel="next", <http://%s/users?page=3>; rel="last"`, req.Host, page+1, req.Host))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func TestPaginate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(pagedHandler))
+	defer server.Close()
+
+	cases := []struct {
+		name     string
+		url      string
+		paginate Paginate
+		expected int
+	}{
+		{"body link", "{{host}}/users", Paginate{Next: "next", Items: "users", Collect: "all"}, 6},
+		{"link header", "{{host}}/users", Paginate{Link: "next", Items: "users", Collect: "all"}, 6},
+		{"page numbers", "{{host}}/users?page={{_page}}", Paginate{Until: "{{_page}} == 2", Items: "users", Collect: "all"}, 4},
+		{"until", "{{host}}/users", Paginate{Next: "next", Until: "{{all | len}} >= 4", Items: "users", Collect: "all"}, 4},
+		{"max pages", "{{host}}/users", Paginate{Next: "next", MaxPages: 1, Items: "users", Collect: "all"}, 2},
+	}
+
+	for _, c := range cases {
+		env := Environment{Vars: map[string]interface{}{"host": server.URL}}
+		r := Request{Name: c.name, URL: c.url, Method: "get", Paginate: &c.paginate}
+		if _, _, err := paginate(r, 1, env, RunOptions{}); err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		items, _ := env.Vars["all"].([]interface{})
+		if len(items) != c.expected {
+			t.Errorf("%s: expected %v items, received %v", c.name, c.expected, items)
+		}
+		if _, ok := env.Vars[nextPageVar]; ok {
+			t.Errorf("%s: pagination vars were not removed", c.name)
+		}
+	}
+
+	// every page is checked against the expect block
+	env := Environment{Vars: map[string]interface{}{"host": server.URL}}
+	r := Request{
+		Name:     "failing page",
+		URL:      "{{host}}/users",
+		Method:   "get",
+		Expect:   Expect{Text: &TextExpectation{Contains: stringList{"user1-a"}}},
+		Paginate: &Paginate{Next: "next"},
+	}
+	if _, _, err := paginate(r, 1, env, RunOptions{}); err == nil {
+		t.Error("expected the second page to fail")
+	}
+}
+
+func TestPaginateSnapshots(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(pagedHandler))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "apitest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	env := Environment{Vars: map[string]interface{}{"host": server.URL}}
+	r := Request{
+		Name:     "List users",
+		URL:      "{{host}}/users",
+		Method:   "get",
+		Expect:   Expect{Snapshot: &Snapshot{Enabled: true, path: filepath.Join(dir, "list-users.json")}},
+		Paginate: &Paginate{Next: "next"},
+	}
+
+	// each page is stored in its own snapshot, so the second run matches every page
+	for run := 1; run <= 2; run++ {
+		if _, _, err := paginate(r, 1, env, RunOptions{}); err != nil {
+			t.Fatalf("run %v: %v", run, err)
+		}
+	}
+	for page := 1; page <= 3; page++ {
+		if _, err := os.Stat(filepath.Join(dir, fmt.Sprintf("list-users.page-%v.json", page))); err != nil {
+			t.Errorf("page %v: %v", page, err)
+		}
+	}
+}
+
+func TestLinkHeaderURL(t *testing.T) {
+	header := `<https://api.example.com/items?page=2>; rel="next", <https://api.example.com/items?page=9>; rel="last"`
+	if u := linkHeaderURL(header, "next"); u != "https://api.example.com/items?page=2" {
+		t.Errorf("unexpected next link %s", u)
+	}
+	if u := linkHeaderURL(header, "prev"); u != "" {
+		t.Errorf("unexpected prev link %s", u)
+	}
+}
+
+func TestPaginateYAML(t *testing.T) {
+	r := Request{}
+	if err := yaml.Unmarshal([]byte("paginate:\n  maxPages: 3\n"), &r); err != nil {
+		t.Error(err)
+	}
+	if r.Paginate == nil || r.Paginate.MaxPages != 3 {
+		t.Errorf("unexpected paginate block %+v", r.Paginate)
+	}
+
+	// without next, link or until, paging would only stop at the default maxPages
+	if err := yaml.Unmarshal([]byte("paginate:\n  collect: all\n"), &Request{}); err == nil {
+		t.Error("expected an error for a paginate block with no way to stop")
+	}
+}
@@ -8,10 +8,10 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"mime"
 	"net/http"
 	"net/url"
 	"strings"
-	"text/template"
 	"time"
 
 	"github.com/savaki/jq"
@@ -19,13 +19,15 @@ import (
 
 // request makes an http client request and checks the response body and response status
 // against any Expect conditions provided
-func request(request Request, count int, env Environment, verbose bool) (string, time.Duration, error) {
+func request(request Request, count int, env Environment, opts RunOptions) (string, time.Duration, error) {
 	var duration time.Duration
 	method := strings.ToUpper(request.Method)
 	expect := request.Expect
 
+	vars := request.vars(env)
+
 	// replace template tags/variables in the URL
-	reqURL, err := replaceURLVars(request.URL, env.Vars)
+	reqURL, err := replaceURLVars(request.URL, vars)
 	if err != nil {
 		return reqURL, duration, err
 	}
@@ -37,7 +39,7 @@ func request(request Request, count int, env Environment, verbose bool) (string,
 	}
 
 	// replace variables in the headers
-	headers, err = setRequestHeaders(headers, env.Vars)
+	headers, err = setRequestHeaders(headers, vars)
 	if err != nil {
 		return reqURL, duration, err
 	}
@@ -47,7 +49,12 @@ func request(request Request, count int, env Environment, verbose bool) (string,
 
 	// set up request and client
 	var req *http.Request
+	transport, err := env.TLS.transport()
+	if err != nil {
+		return reqURL, duration, err
+	}
 	client := &http.Client{
+		Transport: transport,
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			// Do not follow redirects
 			return http.ErrUseLastResponse
@@ -62,13 +69,13 @@ func request(request Request, count int, env Environment, verbose bool) (string,
 
 		headers["Content-Type"] = "application/x-www-form-urlencoded"
 
-		form, err := replaceBodyVars(request.Body, env.Vars)
+		form, err := replaceBodyVars(request.Body, vars)
 		if err != nil {
 			return reqURL, duration, err
 		}
 		formData := url.Values{}
 		for k, v := range form {
-			formData.Set(k, fmt.Sprintf("%s", v))
+			formData.Set(k, fmt.Sprintf("%v", v))
 		}
 
 		req, err = http.NewRequest(method, reqURL, strings.NewReader(formData.Encode()))
@@ -80,7 +87,7 @@ func request(request Request, count int, env Environment, verbose bool) (string,
 
 		// process template tags/variables in the request body and
 		// store as a new variable
-		bodyJSON, err := replaceBodyVars(request.Body, env.Vars)
+		bodyJSON, err := replaceBodyVars(request.Body, vars)
 		if err != nil {
 			return reqURL, duration, err
 		}
@@ -102,8 +109,36 @@ func request(request Request, count int, env Environment, verbose bool) (string,
 		req.Header.Add(k, v)
 	}
 
+	// a request's own auth replaces the environment's auth
+	auth := env.Auth
+	if request.Auth != nil {
+		auth = request.Auth
+	}
+	// credentials (e.g. OAuth2 tokens) come from other hosts, which get the CA bundle
+	// but not the server name or client certificate
+	tokenTransport, err := env.TLS.otherHosts().transport()
+	if err != nil {
+		return reqURL, duration, err
+	}
+	if err := applyAuth(req, auth, vars, tokenTransport); err != nil {
+		return reqURL, duration, err
+	}
+	// signatures cover the body and headers, so requests are signed last
+	if err := signRequest(req, auth, vars); err != nil {
+		return reqURL, duration, err
+	}
+
 	t0 := time.Now()
 	resp, err := client.Do(req)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized {
+		// digest auth answers the server's challenge with a second request,
+		// and the response time is the time taken by the second request
+		var retried time.Time
+		resp, retried, err = answerDigest(client, req, resp, auth, vars)
+		if !retried.IsZero() {
+			t0 = retried
+		}
+	}
 	if err != nil {
 		return reqURL, duration, err
 	}
@@ -119,19 +154,112 @@ func request(request Request, count int, env Environment, verbose bool) (string,
 	failCount := 0
 
 	// Check that status code matches the expected value, return with an error message on fail
-	if resp.StatusCode != expect.Status {
-		if verbose {
+	if err := expect.Status.check(resp.StatusCode); err != nil {
+		if opts.Verbose {
 			log.Printf("%s", body)
 		}
-		return reqURL, duration, fmt.Errorf("  FAIL expected: %v received: %v", expect.Status, resp.StatusCode)
+		return reqURL, duration, fmt.Errorf("  FAIL %v", err)
 	}
 	log.Printf("  OK status is %v", resp.StatusCode)
 
+	// Check the response time against the request's maximum duration, or the
+	// default for the environment if the request doesn't have one.
+	maxDuration := expect.MaxDuration.Duration
+	if maxDuration == 0 {
+		maxDuration = env.MaxDuration.Duration
+	}
+	if maxDuration > 0 {
+		if duration > maxDuration {
+			failCount++
+			log.Printf("  FAIL, response time %v exceeded maximum duration %v", duration, maxDuration)
+			if opts.Monitor {
+				hostname, path := processURL(reqURL)
+				recordSlowRequest(request.Name, hostname, path, method)
+			}
+		} else {
+			log.Printf("  ✓  response time %v within %v", duration, maxDuration)
+		}
+	}
+
+	// In monitor mode, record when the server's certificates expire
+	if opts.Monitor {
+		if expiry, ok := certExpiry(resp.TLS); ok {
+			recordCertExpiry(req.URL.Hostname(), time.Until(expiry).Seconds())
+		}
+	}
+
+	// Check the server's certificate and TLS connection
+	if expect.TLS != nil {
+		tlsErrs := checkTLS(resp.TLS, *expect.TLS)
+		for _, err := range tlsErrs {
+			failCount++
+			log.Println("  FAIL,", err)
+		}
+		if len(tlsErrs) == 0 {
+			log.Println("  ✓  TLS certificate matches rules")
+		}
+	}
+
+	// Compare the response against a stored snapshot (or store one if it doesn't exist yet)
+	if expect.Snapshot != nil && expect.Snapshot.Enabled {
+		if err := checkSnapshot(*expect.Snapshot, resp, body, opts.UpdateSnapshots); err != nil {
+			failCount++
+			log.Println("  FAIL,", err)
+		}
+	}
+
+	// Check text rules against the raw response body
+	if expect.Text != nil {
+		textErrs := checkText(string(body), *expect.Text)
+		for _, err := range textErrs {
+			failCount++
+			log.Println("  FAIL,", err)
+		}
+		if len(textErrs) == 0 {
+			log.Println("  ✓  body text matches rules")
+		}
+	}
+
+	// Check XML values using XPath selectors
+	if len(expect.XML) > 0 {
+		doc, err := parseXML(body)
+		if err != nil {
+			failCount++
+			log.Println("  FAIL,", err)
+		} else {
+			for k, v := range expect.XML {
+				err := checkXMLResponse(doc, k, v)
+				if err != nil {
+					failCount++
+					log.Println("  FAIL,", k, err)
+				} else {
+					log.Printf("  ✓  %v equal to: %v", k, v)
+				}
+			}
+		}
+	}
+
+	// Set user vars (defined by a `set:` block in the request spec)
+	if err := setUserVars(request.SetVars, resp, body, duration, env.Vars); err != nil {
+		return reqURL, duration, err
+	}
+	for _, v := range request.SetVars {
+		env.fix(v.Name)
+	}
+
 	// if the response is not JSON, end the request here.
-	if !contains(resp.Header["Content-Type"], "application/json") {
-		if verbose {
+	if !isJSON(resp.Header) {
+		if opts.Verbose {
 			log.Printf("%s", body)
 		}
+		// JSON assertions can't be checked, so they are reported as failures instead of being skipped.
+		if len(expect.Values) > 0 || expect.Body != nil {
+			failCount++
+			log.Printf("  FAIL, expected a JSON response to check values/body but received Content-Type: %s", resp.Header.Get("Content-Type"))
+		}
+		if failCount > 0 {
+			return reqURL, duration, fmt.Errorf("  %v failing conditions", failCount)
+		}
 		return reqURL, duration, nil
 	}
 
@@ -144,7 +272,7 @@ func request(request Request, count int, env Environment, verbose bool) (string,
 		return reqURL, duration, fmt.Errorf("ERROR %s %s could not decode response body", method, reqURL)
 	}
 
-	if verbose {
+	if opts.Verbose {
 		out, err := json.MarshalIndent(respBodyJSON, "", "  ")
 		if err != nil {
 			return reqURL, duration, fmt.Errorf("ERROR %s %s could not print response body in verbose mode", method, reqURL)
@@ -165,26 +293,14 @@ func request(request Request, count int, env Environment, verbose bool) (string,
 
 	}
 
-	// Set user vars (defined by a `set:` block in the request spec)
-	for _, v := range request.SetVars {
-		selector := v.Key
-		if c := fmt.Sprintf("%c", selector[0]); c != "." {
-			selector = "." + selector
-		}
-
-		op, err := jq.Parse(selector)
-		if err != nil {
-			return reqURL, duration, fmt.Errorf("error setting variable from selector %s. Use jq format: e.g. foo or .foo.bar or foo.bar (all valid)", selector)
-		}
-
-		value, err := op.Apply(body)
-		if err != nil {
-			return reqURL, duration, fmt.Errorf("error finding value for key %s to use as variable. Key may not exist. Hint: Use jq format: e.g. foo or .foo.bar or foo.bar (all valid)", selector)
+	// Compare the whole response body
+	if expect.Body != nil {
+		if err := checkBody(respBodyJSON, *expect.Body); err != nil {
+			failCount++
+			log.Println("  FAIL,", err)
+		} else {
+			log.Println("  ✓  body equal to expected body")
 		}
-
-		var setValue interface{}
-		json.Unmarshal(value, &setValue)
-		env.Vars[v.Name] = setValue
 	}
 
 	if failCount > 0 {
@@ -195,88 +311,97 @@ func request(request Request, count int, env Environment, verbose bool) (string,
 	return reqURL, duration, nil
 }
 
-// replaceVars takes a string with template tags and a map of variables and uses the
-// text/template package to replace the template variables.
+// vars returns the variables used to render the request's templates.
+// Request vars (e.g. from a data row) are added to a copy of the environment vars,
+// so they are only available to this request.
+func (request Request) vars(env Environment) map[string]interface{} {
+	if len(request.Vars) == 0 {
+		return env.Vars
+	}
+	vars := make(map[string]interface{}, len(env.Vars)+len(request.Vars))
+	for k, v := range env.Vars {
+		vars[k] = v
+	}
+	for k, v := range request.Vars {
+		vars[k] = v
+	}
+	return vars
+}
+
+// replaceVars takes a string with template tags and a map of variables and
+// replaces the template tags with their values.
 // It returns back a new string.
 func replaceURLVars(url string, vars map[string]interface{}) (string, error) {
-
-	var urlBuffer bytes.Buffer
-
 	// URL template tag variable replacement
-	// parse URL string with text/template, and return a new
-	// string with any {{ variables }} replaced with the values in the
+	// return a new string with any {{ variables }} replaced with the values in the
 	// vars map.
-	urlTemplate, err := template.New("url").Parse(url)
-	if err != nil {
-		return url, err
-	}
-
-	err = urlTemplate.Execute(&urlBuffer, vars)
-	if err != nil {
-		return url, err
-	}
-	url = urlBuffer.String()
-
-	return url, nil
+	return renderTemplate("url", url, vars)
 }
 
 // setRequestHeaders replaces all variables in each header.
-// the headers map is stringified first, then variables are replaced,
-// and then the headers are marshalled back to a map[string]string.
+// each header value is rendered as its own template and a new map is returned.
 func setRequestHeaders(headers map[string]string, vars map[string]interface{}) (map[string]string, error) {
+	rendered := make(map[string]string, len(headers))
 
-	var headerBuffer bytes.Buffer
-
-	headerJSON, err := json.Marshal(headers)
-	if err != nil {
-		return headers, err
-	}
-
-	headerTemplate, err := template.New("header").Parse(string(headerJSON))
-	if err != nil {
-		return headers, err
-	}
-
-	err = headerTemplate.Execute(&headerBuffer, vars)
-	if err != nil {
-		return headers, err
-	}
-
-	err = json.Unmarshal(headerBuffer.Bytes(), &headers)
-	if err != nil {
-		return headers, err
+	for k, v := range headers {
+		value, err := renderTemplate("header", v, vars)
+		if err != nil {
+			return headers, err
+		}
+		rendered[k] = value
 	}
 
-	return headers, nil
+	return rendered, nil
 }
 
 // replaceBodyVars replaces all variables in the request body.
 // interface{} is used here due to the unknown schema in the test spec file.
+// The body is walked and every string value is rendered as a template, so the
+// request spec's body is left unmodified for the next run.
 func replaceBodyVars(body map[string]interface{}, vars map[string]interface{}) (map[string]interface{}, error) {
-
-	var bodyBuffer bytes.Buffer
-
-	bodyJSON, err := json.Marshal(body)
-	if err != nil {
-		return body, err
-	}
-
-	headerTemplate, err := template.New("body").Parse(string(bodyJSON))
-	if err != nil {
-		return body, err
-	}
-
-	err = headerTemplate.Execute(&bodyBuffer, vars)
+	rendered, err := replaceValueVars(body, vars)
 	if err != nil {
 		return body, err
 	}
+	return rendered.(map[string]interface{}), nil
+}
 
-	err = json.Unmarshal(bodyBuffer.Bytes(), &body)
-	if err != nil {
-		return body, err
+// replaceValueVars returns a copy of a value with variables replaced in all strings
+// (including strings nested in maps and lists). Values are never converted to JSON text
+// and back, so strings containing quotes or other special characters are encoded correctly
+// when the body is serialized.
+func replaceValueVars(value interface{}, vars map[string]interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if v == nil {
+			return v, nil
+		}
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			rendered, err := replaceValueVars(item, vars)
+			if err != nil {
+				return value, err
+			}
+			out[k] = rendered
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			rendered, err := replaceValueVars(item, vars)
+			if err != nil {
+				return value, err
+			}
+			out[i] = rendered
+		}
+		return out, nil
+	case string:
+		// a value that is exactly one template tag (e.g. "{{count}}") keeps the value's
+		// type, so numbers, booleans, objects and arrays aren't converted to strings.
+		return renderValue("body", v, vars)
+	default:
+		return v, nil
 	}
-
-	return body, nil
 }
 
 // checkJSONResponse compares two values of arbitrary type.
@@ -339,6 +464,21 @@ func checkJSONResponse(body []byte, selector string, expectedValue interface{},
 
 }
 
+// isJSON returns true if the Content-Type header is a JSON media type: application/json,
+// or a type with a +json suffix (e.g. application/problem+json).
+func isJSON(header http.Header) bool {
+	for _, contentType := range header["Content-Type"] {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			continue
+		}
+		if mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+			return true
+		}
+	}
+	return false
+}
+
 // contains is a helper function to check if a slice of strings contains a particular string.
 // each string in the slice need only contain a substring, a full match is not necessary
 func contains(s []string, substring string) bool {
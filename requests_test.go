@@ -5,6 +5,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 // basicRequestHandler is a test handler that returns different responses
@@ -65,8 +68,9 @@ func TestRequestSet(t *testing.T) {
 	// this is fragile, and will fail if more requests are added to the test.yaml file
 	// todo:  rework test to focus more on logic, less on yaml file staying the same.
 	expectedTotal, expectedFails := 2, 0
-	// the third argument is the test request name to run, and an empty string means all tests.
-	total, fails := runRequests(set.Requests, set.Environment, "", false, false)
+	// an empty TestName in the run options means all tests.
+	summary := runRequests(set.Requests, set.Environment, RunOptions{})
+	total, fails := summary.Total, summary.Failed
 
 	if total != expectedTotal {
 		t.Errorf("Expected '%v', received '%v'", expectedTotal, total)
@@ -98,7 +102,8 @@ func TestRequestSingle(t *testing.T) {
 	// this is fragile, and will fail if more requests are added to the test.yaml file
 	// todo:  rework test to focus more on logic, less on yaml file staying the same.
 	expectedTotal, expectedFails := 1, 0
-	total, fails := runRequests(set.Requests, set.Environment, testName, false, false)
+	summary := runRequests(set.Requests, set.Environment, RunOptions{TestNames: []string{testName}})
+	total, fails := summary.Total, summary.Failed
 
 	if total != expectedTotal {
 		t.Errorf("Expected '%v', received '%v'", expectedTotal, total)
@@ -193,3 +198,163 @@ func TestNonStrictJSONComparison(t *testing.T) {
 		}
 	}
 }
+
+func TestMaxDuration(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	env := Environment{Vars: map[string]interface{}{}}
+	r := Request{Name: "slow request", URL: server.URL, Method: "get", Expect: Expect{Status: StatusExpectation{Codes: []int{200}}}}
+
+	r.Expect.MaxDuration = Duration{10 * time.Millisecond}
+	if _, _, err := request(r, 1, env, RunOptions{}); err == nil {
+		t.Error("expected request exceeding maxDuration to fail")
+	}
+
+	// the environment default is used when the request has no maxDuration
+	r.Expect.MaxDuration = Duration{}
+	env.MaxDuration = Duration{time.Second}
+	if _, _, err := request(r, 1, env, RunOptions{}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDurationYAML(t *testing.T) {
+	var e Expect
+	if err := yaml.Unmarshal([]byte("maxDuration: 250ms"), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.MaxDuration.Duration != 250*time.Millisecond {
+		t.Errorf("Expected '%v', received '%v'", 250*time.Millisecond, e.MaxDuration.Duration)
+	}
+
+	if err := yaml.Unmarshal([]byte("maxDuration: fast"), &e); err == nil {
+		t.Error("expected an invalid duration to return an error")
+	}
+}
+
+func TestNonJSONResponse(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("hello world"))
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	env := Environment{Vars: map[string]interface{}{}}
+	r := Request{Name: "text response", URL: server.URL, Method: "get", Expect: Expect{Status: StatusExpectation{Codes: []int{200}}}}
+
+	r.Expect.Text = &TextExpectation{Contains: stringList{"hello"}}
+	if _, _, err := request(r, 1, env, RunOptions{}); err != nil {
+		t.Error(err)
+	}
+
+	// JSON assertions against a text response are failures, not skipped
+	r.Expect.Values = map[string]interface{}{"hello": "world"}
+	if _, _, err := request(r, 1, env, RunOptions{}); err == nil {
+		t.Error("expected JSON value assertions on a text response to fail")
+	}
+}
+
+func TestJSONMediaTypes(t *testing.T) {
+	contentType := ""
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"title": "not found"}`))
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	cases := []struct {
+		contentType string
+		json        bool
+	}{
+		{"application/json", true},
+		{"application/json; charset=utf-8", true},
+		{"application/problem+json", true},
+		{"Application/VND.API+JSON", true},
+		{"text/plain", false},
+		{"application/jsonp", false},
+	}
+
+	env := Environment{Vars: map[string]interface{}{}}
+	for _, c := range cases {
+		contentType = c.contentType
+		r := Request{
+			Name:   c.contentType,
+			URL:    server.URL,
+			Method: "get",
+			Expect: Expect{Status: StatusExpectation{Codes: []int{200}}, Values: map[string]interface{}{"title": "not found"}},
+		}
+		_, _, err := request(r, 1, env, RunOptions{})
+		if c.json && err != nil {
+			t.Errorf("%s: %v", c.contentType, err)
+		}
+		if !c.json && err == nil {
+			t.Errorf("%s: expected JSON assertions to fail", c.contentType)
+		}
+	}
+}
+
+func TestReplaceBodyVars(t *testing.T) {
+	vars := map[string]interface{}{"name": "alice"}
+	body := map[string]interface{}{
+		"user":  "{{.name}}",
+		"email": `{{ .name }}@{{ "example.com" }}`,
+		"tags":  []interface{}{"{{.name}}", 1},
+	}
+
+	rendered, err := replaceBodyVars(body, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rendered["email"] != "alice@example.com" {
+		t.Errorf("Expected '%v', received '%v'", "alice@example.com", rendered["email"])
+	}
+	if rendered["tags"].([]interface{})[0] != "alice" {
+		t.Errorf("Expected '%v', received '%v'", "alice", rendered["tags"].([]interface{})[0])
+	}
+
+	// the original body is not modified, so it can be rendered again with new vars
+	if body["user"] != "{{.name}}" {
+		t.Errorf("Expected '%v', received '%v'", "{{.name}}", body["user"])
+	}
+}
+
+func TestReplaceBodyVarsKeepsTypes(t *testing.T) {
+	vars := map[string]interface{}{
+		"count":   5,
+		"enabled": true,
+		"user":    map[string]interface{}{"id": 1},
+		"quote":   `she said "hi"`,
+	}
+	body := map[string]interface{}{
+		"count":   "{{.count}}",
+		"enabled": "{{ .enabled }}",
+		"user":    "{{.user}}",
+		"label":   "count: {{.count}}",
+		"quote":   "{{.quote}}!",
+	}
+
+	rendered, err := replaceBodyVars(body, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := json.Marshal(rendered)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"count":5,"enabled":true,"label":"count: 5","quote":"she said \"hi\"!","user":{"id":1}}`
+	if string(out) != expected {
+		t.Errorf("Expected '%v', received '%v'", expected, string(out))
+	}
+}
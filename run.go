@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// testRun holds the state of a single run through a test set. Results are shared
+// between the setup, requests and teardown phases, so that requests can depend
+// on setup requests.
+type testRun struct {
+	env Environment
+	// vars are group vars, which override the test spec's environment (see groupVars)
+	vars    map[string]interface{}
+	opts    RunOptions
+	results requestResults
+	// all is every request in the test set, used to report unknown dependencies
+	all []Request
+	// count is the number of requests made so far
+	count int
+	// failures is the number of failed requests, and stopped is the reason
+	// the run was stopped early (see --fail-fast, --max-failures and critical)
+	failures int
+	stopped  string
+	// teardown is true while teardown requests run. Teardown is never stopped early.
+	teardown bool
+}
+
+// runTestSet runs the setup requests, the requests selected by the run options, and then the
+// teardown requests. Teardown always runs, even if setup or other requests failed.
+// Setup failures count as test failures, and if setup fails the requests are skipped.
+// If the run is stopped early, the remaining requests are reported as not run.
+// The summary of the teardown phase is returned separately, so that teardown failures
+// don't mask the result of the test.
+func runTestSet(set TestSet, opts RunOptions) (RunSummary, RunSummary) {
+	root := Group{Setup: set.Setup, Requests: set.Requests, Teardown: set.Teardown, Groups: set.Groups}
+	t := newTestRun(set.Environment, opts, root.everyRequest())
+
+	// groups that have no selected requests are left out, but the test set's
+	// setup and teardown always run
+	i := 0
+	root, _ = root.filter(selectedRequests(root.allRequests(), opts), &i)
+	return t.runGroup(root)
+}
+
+// runRequests accepts a set of Request objects and calls the request() function
+// for each one. Since requests are expected to fail often, errors are not passed
+// up to the calling function, but instead reported to output, tallied
+// and a summary of the request, error and skip counts returned at the end of the run.
+func runRequests(requests []Request, env Environment, opts RunOptions) RunSummary {
+	t := newTestRun(env, opts, requests)
+	return t.run(selectRequests(requests, opts))
+}
+
+func newTestRun(env Environment, opts RunOptions, all []Request) *testRun {
+	// vars set by requests are tracked for the whole run, including environments
+	// that weren't made by buildEnvironment
+	if env.fixed == nil {
+		env.fixed = make(map[string]bool)
+	}
+	return &testRun{env: env, opts: opts, results: requestResults{}, all: all}
+}
+
+// groupVars returns the group vars used for the next request. Group vars override the
+// test spec's environment and profile, but not vars from env files, the command line
+// or secrets, or vars set by earlier requests.
+func (t *testRun) groupVars() map[string]interface{} {
+	vars := make(map[string]interface{}, len(t.vars))
+	for k, v := range t.vars {
+		if !t.env.fixed[k] {
+			vars[k] = v
+		}
+	}
+	return vars
+}
+
+// run makes each request in a list, in order.
+func (t *testRun) run(requests []Request) RunSummary {
+	summary := RunSummary{}
+
+	// iterate through requests and keep track of test fails
+	for _, r := range requests {
+		if t.stopped != "" {
+			log.Printf("   NOT RUN %s (%s)", r.Name, t.stopped)
+			summary.NotRun++
+			continue
+		}
+		method := strings.ToUpper(r.Method)
+		if len(t.vars) > 0 {
+			r.Vars = overlayVars(t.groupVars(), r.Vars)
+		}
+
+		// skipped requests are reported, but not counted as passed or failed
+		skip, reason, err := t.results.dependencyFailed(r, requests, t.all)
+		if err == nil && !skip {
+			skip, reason, err = r.skipReason(r.vars(t.env))
+		}
+		if err != nil {
+			// requests that can't run (e.g. a missing dependency) are failures,
+			// and count as requests so that the summary adds up
+			log.Printf("   %s: %v", r.Name, err)
+			summary.Total++
+			summary.Failed++
+			t.results.record(r, false)
+			t.failed(r)
+			continue
+		}
+		if skip {
+			log.Printf("   SKIP %s (%s)", r.Name, reason)
+			summary.Skipped++
+			t.results.record(r, false)
+			continue
+		}
+
+		summary.Total++
+		t.count++
+
+		// make the request.
+		// the hostname/path is parsed immediately so it's available for both
+		// error handling and the "happy path"
+		var rawURL string
+		var duration time.Duration
+		if r.Paginate != nil {
+			rawURL, duration, err = paginate(r, t.count, t.env, t.opts)
+		} else {
+			rawURL, duration, err = request(r, t.count, t.env, t.opts)
+		}
+		hostname, path := processURL(rawURL)
+		t.results.record(r, err == nil)
+		if err != nil {
+			// actions to take for unsuccessful requests
+			log.Println("  ", err)
+			summary.Failed++
+			t.failed(r)
+			if t.opts.Monitor {
+				recordError(r.Name, hostname, path, method)
+				if errors.As(err, &authError{}) {
+					recordAuthError(r.Name, hostname, path, method)
+				}
+			}
+		}
+
+		durationSeconds := duration.Seconds()
+		recordRequest(r.Name, hostname, path, method)
+		recordDuration(r.Name, hostname, path, method, durationSeconds)
+
+	}
+	return summary
+}
+
+// failed counts a failed request, and stops the run if the request is critical,
+// --fail-fast is on, or the maximum number of failures has been reached.
+// Teardown failures are reported separately, so they aren't counted.
+func (t *testRun) failed(r Request) {
+	if t.teardown {
+		return
+	}
+	t.failures++
+	switch {
+	case r.Critical:
+		t.stopped = fmt.Sprintf("critical request failed: %s", r.Name)
+	case t.opts.FailFast:
+		t.stopped = fmt.Sprintf("stopped after first failure: %s", r.Name)
+	case t.opts.MaxFailures > 0 && t.failures >= t.opts.MaxFailures:
+		t.stopped = fmt.Sprintf("stopped after %v failures", t.failures)
+	}
+}
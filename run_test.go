@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSetupAndTeardown(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(basicRequestHandler))
+	defer server.Close()
+
+	set, err := readTestDefinition("test/setup/setup.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	phases := map[string][]Request{"setup": set.Setup, "requests": set.Requests, "teardown": set.Teardown}
+	expected := map[string]string{
+		"setup":    "Create user,Create todo",
+		"requests": "Get todo,Get missing todo",
+		// teardown runs in the reverse order of setup, so the todo is deleted before the user
+		"teardown": "Delete todo,Delete user",
+	}
+	for phase, requests := range phases {
+		names := []string{}
+		for _, r := range requests {
+			names = append(names, r.Name)
+		}
+		if strings.Join(names, ",") != expected[phase] {
+			t.Errorf("%s: expected '%v', received '%v'", phase, expected[phase], strings.Join(names, ","))
+		}
+	}
+
+	set.Environment.Vars["host"] = server.URL
+
+	// the handler doesn't allow DELETE, so one teardown request fails, but
+	// teardown failures are reported separately from the test result.
+	summary, teardown := runTestSet(set, RunOptions{})
+	if summary.Total != 4 || summary.Failed != 1 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+	if teardown.Total != 2 || teardown.Failed != 1 {
+		t.Errorf("unexpected teardown summary %+v", teardown)
+	}
+
+	// teardown runs, and requests are skipped, when setup fails
+	set.Setup[0].Expect = Expect{Status: StatusExpectation{Codes: []int{500}}}
+	summary, teardown = runTestSet(set, RunOptions{TestNames: []string{"Get todo"}})
+	if summary.Total != 2 || summary.Failed != 1 || summary.Skipped != 1 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+	if teardown.Total != 2 {
+		t.Errorf("unexpected teardown summary %+v", teardown)
+	}
+}
+
+func TestStopEarly(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(basicRequestHandler))
+	defer server.Close()
+
+	ok := Expect{Status: StatusExpectation{Codes: []int{200}}}
+	fail := Expect{Status: StatusExpectation{Codes: []int{404}}}
+	set := TestSet{
+		Environment: Environment{Vars: map[string]interface{}{"host": server.URL}},
+		Requests: []Request{
+			{Name: "a", URL: "{{host}}/a", Method: "get", Expect: fail},
+			{Name: "b", URL: "{{host}}/b", Method: "get", Expect: fail},
+			{Name: "c", URL: "{{host}}/c", Method: "get", Expect: ok},
+			{Name: "d", URL: "{{host}}/d", Method: "get", Expect: fail},
+		},
+		Teardown: []Request{
+			{Name: "cleanup", URL: "{{host}}/cleanup", Method: "get", Expect: ok},
+		},
+	}
+
+	cases := []struct {
+		opts     RunOptions
+		critical bool
+		expected RunSummary
+	}{
+		{RunOptions{}, false, RunSummary{Total: 4, Failed: 3}},
+		{RunOptions{FailFast: true}, false, RunSummary{Total: 1, Failed: 1, NotRun: 3}},
+		{RunOptions{MaxFailures: 2}, false, RunSummary{Total: 2, Failed: 2, NotRun: 2}},
+		{RunOptions{}, true, RunSummary{Total: 2, Failed: 2, NotRun: 2}},
+	}
+
+	for _, c := range cases {
+		set.Requests[1].Critical = c.critical
+		summary, teardown := runTestSet(set, c.opts)
+		if summary != c.expected {
+			t.Errorf("%+v (critical %v): expected %+v, received %+v", c.opts, c.critical, c.expected, summary)
+		}
+		// teardown always runs
+		if teardown.Total != 1 || teardown.Failed != 0 {
+			t.Errorf("unexpected teardown summary %+v", teardown)
+		}
+	}
+
+	// teardown failures don't count towards --max-failures
+	set.Requests = []Request{{Name: "e", URL: "{{host}}/e", Method: "get", Expect: ok}}
+	set.Teardown = nil
+	set.Groups = []Group{
+		{
+			Name:     "Group",
+			Requests: []Request{{Name: "Group > f", URL: "{{host}}/f", Method: "get", Expect: ok}},
+			Teardown: []Request{{Name: "Group > cleanup", URL: "{{host}}/cleanup", Method: "get", Expect: fail}},
+		},
+		{
+			Name: "Later",
+			Requests: []Request{
+				{Name: "Later > g", URL: "{{host}}/g", Method: "get", Expect: fail},
+				{Name: "Later > h", URL: "{{host}}/h", Method: "get", Expect: ok},
+			},
+		},
+	}
+	summary, teardown := runTestSet(set, RunOptions{MaxFailures: 2})
+	expected := RunSummary{Total: 4, Failed: 1}
+	if summary != expected || teardown.Failed != 1 {
+		t.Errorf("expected %+v, received %+v (teardown %+v)", expected, summary, teardown)
+	}
+}
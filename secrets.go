@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// redactedValue replaces secret values in output
+const redactedValue = "[secret]"
+
+// Secret is a variable whose value is redacted from all output. The value
+// can be given directly, or read from an OS environment variable or a file.
+// A secret with only a name marks an existing variable (e.g. one passed with -e) as secret.
+type Secret struct {
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+	Env   string `yaml:"env"`
+	File  string `yaml:"file"`
+}
+
+// secretStore holds the values of every secret seen during a run.
+type secretStore struct {
+	mu     sync.RWMutex
+	values []string
+}
+
+// secrets is used by the log output writer to redact secret values
+var secrets = &secretStore{}
+
+// add registers a value as secret. Values are kept longest first, so that a secret
+// containing another secret is redacted as a whole. The JSON encoded form of the value
+// is also registered, because response values are printed as JSON (e.g. in verbose
+// output and body diffs), which escapes characters like & < > " and \.
+func (s *secretStore) add(value string) {
+	if value == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.addValue(value)
+	if encoded, err := json.Marshal(value); err == nil {
+		s.addValue(string(encoded[1 : len(encoded)-1]))
+	}
+	sort.Slice(s.values, func(i, j int) bool { return len(s.values[i]) > len(s.values[j]) })
+}
+
+func (s *secretStore) addValue(value string) {
+	for _, v := range s.values {
+		if v == value {
+			return
+		}
+	}
+	s.values = append(s.values, value)
+}
+
+// redact replaces all secret values in a string.
+func (s *secretStore) redact(text string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, v := range s.values {
+		text = strings.Replace(text, v, redactedValue, -1)
+	}
+	return text
+}
+
+// redactingWriter redacts secret values before writing to the underlying writer.
+// It is used as the log output, so secrets are removed from request logs,
+// verbose output and error messages.
+type redactingWriter struct {
+	w io.Writer
+}
+
+func (r *redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, secrets.redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// resolve returns the value of a secret from its value, env variable or file.
+// ok is false if the secret only has a name (it refers to an existing variable).
+func (s Secret) resolve() (value string, ok bool, err error) {
+	switch {
+	case s.Value != "":
+		return s.Value, true, nil
+	case s.Env != "":
+		v, found := os.LookupEnv(s.Env)
+		if !found {
+			return "", false, fmt.Errorf("secret %s: environment variable %s is not set", s.Name, s.Env)
+		}
+		return v, true, nil
+	case s.File != "":
+		b, err := ioutil.ReadFile(s.File)
+		if err != nil {
+			return "", false, fmt.Errorf("secret %s: %v", s.Name, err)
+		}
+		return strings.TrimRight(string(b), "\r\n"), true, nil
+	}
+	return "", false, nil
+}
+
+// resolveSecretFiles makes the file paths of secrets relative to the test spec file.
+func resolveSecretFiles(specSecrets []Secret, specFile string) {
+	for i, s := range specSecrets {
+		if s.File != "" && !filepath.IsAbs(s.File) {
+			specSecrets[i].File = filepath.Join(filepath.Dir(specFile), s.File)
+		}
+	}
+}
+
+// processSecrets adds secrets to the environment's vars and marks their values as secret.
+// Secrets from the command line (-s name=value) are processed after secrets defined in the spec.
+func (env Environment) processSecrets(specSecrets []Secret, cliSecrets []string) error {
+	for _, s := range specSecrets {
+		if s.Name == "" {
+			return errors.New("secrets must have a name")
+		}
+		value, ok, err := s.resolve()
+		if err != nil {
+			return err
+		}
+		if ok {
+			env.Vars[s.Name] = value
+		}
+		if v, exists := env.Vars[s.Name]; exists {
+			secrets.add(templateString(v))
+			env.fix(s.Name)
+		}
+	}
+
+	for _, s := range cliSecrets {
+		i := strings.Index(s, "=")
+		if i < 1 {
+			return errors.New("Error processing secrets.  Usage example: -s token=$TOKEN")
+		}
+		env.Vars[s[:i]] = s[i+1:]
+		env.fix(s[:i])
+		secrets.add(s[i+1:])
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+// resetSecrets clears the global secret store, so that values added by one test
+// aren't redacted in other tests.
+func resetSecrets() {
+	secrets.mu.Lock()
+	defer secrets.mu.Unlock()
+	secrets.values = nil
+}
+
+func TestRedactSecrets(t *testing.T) {
+	store := &secretStore{}
+	store.add("abc")
+	store.add("abc123")
+	store.add("")
+
+	out := store.redact("token abc123, key abc, empty ''")
+	expected := "token [secret], key [secret], empty ''"
+	if out != expected {
+		t.Errorf("Expected '%v', received '%v'", expected, out)
+	}
+}
+
+func TestRedactJSONSecrets(t *testing.T) {
+	// JSON output escapes these characters, e.g. & is printed as \u0026
+	secret := `s3&cr<t>"\'`
+	store := &secretStore{}
+	store.add(secret)
+
+	indented, _ := json.MarshalIndent(map[string]interface{}{"password": secret}, "", "  ")
+	for _, out := range []string{secret, formatValue(secret), string(indented)} {
+		if redacted := store.redact(out); strings.Contains(redacted, "s3") {
+			t.Errorf("secret not redacted: %s", redacted)
+		}
+	}
+}
+
+func TestProcessSecrets(t *testing.T) {
+	resetSecrets()
+	defer resetSecrets()
+
+	os.Setenv("APITEST_SECRET_TEST", "from-env-value")
+	defer os.Unsetenv("APITEST_SECRET_TEST")
+
+	f, err := ioutil.TempFile("", "apitest-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("from-file-value\n")
+	f.Close()
+
+	env := Environment{Vars: map[string]interface{}{"existing": "existing-value"}}
+	specSecrets := []Secret{
+		Secret{Name: "from_env", Env: "APITEST_SECRET_TEST"},
+		Secret{Name: "from_file", File: f.Name()},
+		Secret{Name: "existing"},
+	}
+
+	if err := env.processSecrets(specSecrets, []string{"cli=cli-value=="}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"from_env":  "from-env-value",
+		"from_file": "from-file-value",
+		"existing":  "existing-value",
+		"cli":       "cli-value==",
+	}
+	for k, v := range expected {
+		if env.Vars[k] != v {
+			t.Errorf("%s: expected '%v', received '%v'", k, v, env.Vars[k])
+		}
+	}
+
+	// all values are redacted from the log output
+	var buf bytes.Buffer
+	logger := log.New(&redactingWriter{w: &buf}, "", 0)
+	logger.Println("from-env-value from-file-value existing-value cli-value==")
+	if strings.TrimSpace(buf.String()) != "[secret] [secret] [secret] [secret]" {
+		t.Errorf("secrets not redacted: %s", buf.String())
+	}
+
+	if err := env.processSecrets([]Secret{Secret{Name: "missing", Env: "APITEST_MISSING_SECRET"}}, nil); err == nil {
+		t.Error("expected an error for a missing environment variable")
+	}
+}
+
+func TestSecretUserVar(t *testing.T) {
+	resetSecrets()
+	defer resetSecrets()
+
+	resp := &http.Response{StatusCode: 200, Header: http.Header{}}
+	body := []byte(`{"access_token": "token-from-login"}`)
+	vars := make(map[string]interface{})
+
+	if err := setUserVars([]UserVar{UserVar{Name: "auth_token", Key: "access_token", Secret: true}}, resp, body, 0, vars); err != nil {
+		t.Fatal(err)
+	}
+
+	if out := secrets.redact("Bearer token-from-login"); out != "Bearer [secret]" {
+		t.Errorf("Expected '%v', received '%v'", "Bearer [secret]", out)
+	}
+}
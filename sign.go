@@ -0,0 +1,320 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AWSSigV4 signs requests with AWS Signature Version 4, e.g. for API Gateway endpoints
+// using IAM auth. Values that are not set are read from the standard AWS environment
+// variables (AWS_REGION, AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN).
+// Service defaults to execute-api.
+type AWSSigV4 struct {
+	Region          string `yaml:"region"`
+	Service         string `yaml:"service"`
+	AccessKeyID     string `yaml:"accessKeyId"`
+	SecretAccessKey string `yaml:"secretAccessKey"`
+	SessionToken    string `yaml:"sessionToken"`
+}
+
+// HMACSignature signs requests with an HMAC of the method, path, date and a digest of the body.
+// The signed string and the signature header can be laid out with templates, using the vars
+// {{method}}, {{path}} (including the query), {{date}}, {{digest}} (the base64 encoded SHA-256 of
+// the body), {{keyId}} and {{signature}}, as well as environment vars.
+type HMACSignature struct {
+	Key   string `yaml:"key"`
+	KeyID string `yaml:"keyId"`
+	// Algorithm is md5, sha1, sha256 (default) or sha512
+	Algorithm string `yaml:"algorithm"`
+	// Encoding of the signature: base64 (default) or hex
+	Encoding string `yaml:"encoding"`
+	// StringToSign defaults to the method, path, date and digest on separate lines
+	StringToSign string `yaml:"stringToSign"`
+	// Header is the header the signature is sent in (default Authorization), formatted with Format
+	// (default "HMAC {{keyId}}:{{signature}}", or "HMAC {{signature}}" without a key id)
+	Header string `yaml:"header"`
+	Format string `yaml:"format"`
+	// DateHeader is the header the date is sent in (default Date)
+	DateHeader string `yaml:"dateHeader"`
+	// DigestHeader is an optional header to send the body digest in, e.g. Digest
+	DigestHeader string `yaml:"digestHeader"`
+}
+
+const (
+	awsDateFormat     = "20060102T150405Z"
+	awsAlgorithm      = "AWS4-HMAC-SHA256"
+	defaultHMACString = "{{method}}\n{{path}}\n{{date}}\n{{digest}}"
+)
+
+// signRequest signs a request with the signatures configured in auth. It is called after
+// the request body and all other headers are set, because they are part of the signature.
+func signRequest(req *http.Request, auth *Auth, vars map[string]interface{}) error {
+	if auth == nil || (auth.AWS == nil && auth.HMAC == nil) {
+		return nil
+	}
+
+	body := []byte{}
+	if req.GetBody != nil {
+		rc, err := req.GetBody()
+		if err != nil {
+			return authError{err}
+		}
+		defer rc.Close()
+		if body, err = ioutil.ReadAll(rc); err != nil {
+			return authError{err}
+		}
+	}
+
+	if auth.HMAC != nil {
+		if err := auth.HMAC.sign(req, body, vars, time.Now()); err != nil {
+			return authError{err}
+		}
+	}
+	if auth.AWS != nil {
+		aws, err := auth.AWS.render(vars)
+		if err != nil {
+			return authError{err}
+		}
+		if err := aws.sign(req, body, time.Now()); err != nil {
+			return authError{err}
+		}
+	}
+	return nil
+}
+
+// render replaces template tags in the settings, and fills in missing values from the
+// AWS environment variables.
+func (a AWSSigV4) render(vars map[string]interface{}) (AWSSigV4, error) {
+	fields := []struct {
+		value *string
+		env   []string
+	}{
+		{&a.Region, []string{"AWS_REGION", "AWS_DEFAULT_REGION"}},
+		{&a.Service, nil},
+		{&a.AccessKeyID, []string{"AWS_ACCESS_KEY_ID"}},
+		{&a.SecretAccessKey, []string{"AWS_SECRET_ACCESS_KEY"}},
+		{&a.SessionToken, []string{"AWS_SESSION_TOKEN"}},
+	}
+	for _, f := range fields {
+		value, err := renderTemplate("auth", *f.value, vars)
+		if err != nil {
+			return a, err
+		}
+		for _, name := range f.env {
+			if value == "" {
+				value = os.Getenv(name)
+			}
+		}
+		*f.value = value
+	}
+	if a.Service == "" {
+		a.Service = "execute-api"
+	}
+	secrets.add(a.SecretAccessKey)
+	secrets.add(a.SessionToken)
+	return a, nil
+}
+
+// sign adds an AWS Signature Version 4 Authorization header to a request.
+func (a AWSSigV4) sign(req *http.Request, body []byte, t time.Time) error {
+	if a.Region == "" || a.AccessKeyID == "" || a.SecretAccessKey == "" {
+		return fmt.Errorf("aws signing needs a region, access key id and secret access key")
+	}
+
+	t = t.UTC()
+	amzDate := t.Format(awsDateFormat)
+	payloadHash := sha256Hex(string(body))
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if a.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", a.SessionToken)
+	}
+	if a.Service == "s3" {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	// every header is signed, along with the host
+	headers := map[string]string{"host": req.URL.Host}
+	if req.Host != "" {
+		headers["host"] = req.Host
+	}
+	for k, v := range req.Header {
+		name := strings.ToLower(k)
+		if name == "authorization" {
+			continue
+		}
+		headers[name] = strings.Join(strings.Fields(strings.Join(v, ",")), " ")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	canonicalHeaders := ""
+	for _, name := range names {
+		canonicalHeaders += name + ":" + headers[name] + "\n"
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if a.Service != "s3" {
+		// paths are encoded twice, except for S3
+		path = awsEscape(path, false)
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		awsCanonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{t.Format("20060102"), a.Region, a.Service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{awsAlgorithm, amzDate, scope, sha256Hex(canonicalRequest)}, "\n")
+
+	key := []byte("AWS4" + a.SecretAccessKey)
+	for _, part := range []string{t.Format("20060102"), a.Region, a.Service, "aws4_request"} {
+		key = hmacSum(key, part)
+	}
+	signature := hex.EncodeToString(hmacSum(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		awsAlgorithm, a.AccessKeyID, scope, signedHeaders, signature))
+	return nil
+}
+
+func hmacSum(key []byte, message string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
+
+// awsCanonicalQuery returns the query parameters sorted by name and value, URI encoded
+func awsCanonicalQuery(query url.Values) string {
+	params := []string{}
+	for k, values := range query {
+		for _, v := range values {
+			params = append(params, awsEscape(k, true)+"="+awsEscape(v, true))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// awsEscape URI encodes every byte except unreserved characters (and / if encodeSlash is false)
+func awsEscape(s string, encodeSlash bool) string {
+	var buf strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			buf.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			buf.WriteByte(c)
+		default:
+			fmt.Fprintf(&buf, "%%%02X", c)
+		}
+	}
+	return buf.String()
+}
+
+// sign adds the date, and the HMAC signature, to a request
+func (h HMACSignature) sign(req *http.Request, body []byte, vars map[string]interface{}, t time.Time) error {
+	key, err := renderSecret(h.Key, vars)
+	if err != nil {
+		return err
+	}
+	if key == "" {
+		return fmt.Errorf("hmac signing needs a key")
+	}
+	keyID, err := renderTemplate("auth", h.KeyID, vars)
+	if err != nil {
+		return err
+	}
+
+	algorithm := h.Algorithm
+	if algorithm == "" {
+		algorithm = "sha256"
+	}
+	newHash, err := hashFunc(algorithm)
+	if err != nil {
+		return err
+	}
+
+	digestSum := sha256.Sum256(body)
+	digest := base64.StdEncoding.EncodeToString(digestSum[:])
+	date := t.UTC().Format(http.TimeFormat)
+
+	dateHeader := h.DateHeader
+	if dateHeader == "" {
+		dateHeader = "Date"
+	}
+	req.Header.Set(dateHeader, date)
+	if h.DigestHeader != "" {
+		req.Header.Set(h.DigestHeader, "SHA-256="+digest)
+	}
+
+	signVars := overlayVars(vars, map[string]interface{}{
+		"method": req.Method,
+		"path":   req.URL.RequestURI(),
+		"date":   date,
+		"digest": digest,
+		"keyId":  keyID,
+	})
+
+	stringToSign := h.StringToSign
+	if stringToSign == "" {
+		stringToSign = defaultHMACString
+	}
+	message, err := renderTemplate("stringToSign", stringToSign, signVars)
+	if err != nil {
+		return err
+	}
+
+	mac := hmac.New(newHash, []byte(key))
+	mac.Write([]byte(message))
+	sum := mac.Sum(nil)
+	switch h.Encoding {
+	case "", "base64":
+		signVars["signature"] = base64.StdEncoding.EncodeToString(sum)
+	case "hex":
+		signVars["signature"] = hex.EncodeToString(sum)
+	default:
+		return fmt.Errorf("unsupported hmac encoding %s (use base64 or hex)", h.Encoding)
+	}
+
+	format := h.Format
+	if format == "" {
+		format = "HMAC {{signature}}"
+		if keyID != "" {
+			format = "HMAC {{keyId}}:{{signature}}"
+		}
+	}
+	value, err := renderTemplate("format", format, signVars)
+	if err != nil {
+		return err
+	}
+
+	header := h.Header
+	if header == "" {
+		header = "Authorization"
+	}
+	req.Header.Set(header, value)
+	return nil
+}
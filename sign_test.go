@@ -0,0 +1,92 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAWSSigV4(t *testing.T) {
+	resetSecrets()
+	defer resetSecrets()
+
+	// example from the AWS Signature Version 4 documentation
+	req, _ := http.NewRequest("GET", "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+
+	a := AWSSigV4{
+		Region:          "us-east-1",
+		Service:         "iam",
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	if err := a.sign(req, []byte{}, time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, SignedHeaders=content-type;host;x-amz-date, Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7"
+	if req.Header.Get("Authorization") != expected {
+		t.Errorf("Expected '%v', received '%v'", expected, req.Header.Get("Authorization"))
+	}
+
+	if err := (AWSSigV4{Region: "us-east-1"}).sign(req, nil, time.Now()); err == nil {
+		t.Error("expected an error without credentials")
+	}
+}
+
+func TestAWSEscape(t *testing.T) {
+	if s := awsEscape("/a b/c~d", false); s != "/a%20b/c~d" {
+		t.Errorf("unexpected path %s", s)
+	}
+	if s := awsEscape("a+b/c", true); s != "a%2Bb%2Fc" {
+		t.Errorf("unexpected query value %s", s)
+	}
+}
+
+func TestHMACSignature(t *testing.T) {
+	resetSecrets()
+	defer resetSecrets()
+
+	body := `{"a":1}`
+	req, _ := http.NewRequest("POST", "http://example.com/orders?x=1", strings.NewReader(body))
+	date := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	vars := map[string]interface{}{"hmac_key": "k3y"}
+
+	sum := sha256.Sum256([]byte(body))
+	digest := base64.StdEncoding.EncodeToString(sum[:])
+	mac := hmac.New(sha256.New, []byte("k3y"))
+	mac.Write([]byte("POST\n/orders?x=1\nThu, 02 Jan 2020 03:04:05 GMT\n" + digest))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	h := HMACSignature{Key: "{{hmac_key}}", KeyID: "client-1", DigestHeader: "Digest"}
+	if err := h.sign(req, []byte(body), vars, date); err != nil {
+		t.Fatal(err)
+	}
+	if req.Header.Get("Authorization") != "HMAC client-1:"+signature {
+		t.Errorf("unexpected signature %s", req.Header.Get("Authorization"))
+	}
+	if req.Header.Get("Date") != "Thu, 02 Jan 2020 03:04:05 GMT" || req.Header.Get("Digest") != "SHA-256="+digest {
+		t.Errorf("unexpected headers %v", req.Header)
+	}
+
+	// the signed string and header can be laid out with templates
+	h = HMACSignature{
+		Key:          "{{hmac_key}}",
+		Encoding:     "hex",
+		StringToSign: "{{method}} {{path}}",
+		Header:       "X-Signature",
+		Format:       "sig={{signature}}",
+		DateHeader:   "X-Date",
+	}
+	if err := h.sign(req, []byte(body), vars, date); err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := hmacHex("sha256", "k3y", "POST /orders?x=1")
+	if req.Header.Get("X-Signature") != "sig="+expected || req.Header.Get("X-Date") == "" {
+		t.Errorf("unexpected headers %v", req.Header)
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// snapshotDir is the directory (relative to the test spec file) where snapshots are stored.
+const snapshotDir = "__snapshots__"
+
+// Snapshot stores a response the first time a request is run, and compares later
+// responses to the stored copy. It can be enabled with `snapshot: true`, or with a
+// block listing the response headers to include and selectors for values to redact.
+type Snapshot struct {
+	Enabled bool     `yaml:"-"`
+	Headers []string `yaml:"headers"`
+	Redact  []string `yaml:"redact"`
+
+	// path is the snapshot file, set when the test spec is read
+	path string
+}
+
+// snapshotRecord is the content of a snapshot file.
+type snapshotRecord struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    interface{}       `json:"body"`
+}
+
+var slugPattern = regexp.MustCompile(`[^a-z0-9]+`)
+
+// volatile values are replaced before a snapshot is stored or compared,
+// so that ids and dates don't cause snapshots to change on every run.
+var volatilePatterns = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`(?i)[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`), "[uuid]"},
+	{regexp.MustCompile(`\d{4}-\d{2}-\d{2}([T ]\d{2}:\d{2}(:\d{2}(\.\d+)?)?(Z|[+-]\d{2}:?\d{2})?)?`), "[date]"},
+	{regexp.MustCompile(`(Mon|Tue|Wed|Thu|Fri|Sat|Sun), \d{2} \w{3} \d{4} \d{2}:\d{2}:\d{2} \w+`), "[date]"},
+}
+
+// UnmarshalYAML allows a snapshot to be enabled with a boolean (`snapshot: true`)
+// or configured with a block.
+func (s *Snapshot) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		return value.Decode(&s.Enabled)
+	}
+
+	type snapshotOptions Snapshot
+	options := snapshotOptions{}
+	if err := value.Decode(&options); err != nil {
+		return err
+	}
+	*s = Snapshot(options)
+	s.Enabled = true
+	return nil
+}
+
+// snapshotPath returns the file used to store the snapshot for a request.
+// Snapshots for each spec file are kept in their own directory, e.g.
+// __snapshots__/test.yaml/get-a-todo.json
+func snapshotPath(specFile string, requestName string) string {
+	slug := strings.Trim(slugPattern.ReplaceAllString(strings.ToLower(requestName), "-"), "-")
+	if slug == "" {
+		slug = "request"
+	}
+	return filepath.Join(filepath.Dir(specFile), snapshotDir, filepath.Base(specFile), slug+".json")
+}
+
+// checkSnapshotPaths returns an error if two requests would use the same snapshot file,
+// e.g. "Get todo!" and "get-todo", which would overwrite each other's snapshots.
+func checkSnapshotPaths(set TestSet) error {
+	root := Group{Setup: set.Setup, Requests: set.Requests, Teardown: set.Teardown, Groups: set.Groups}
+	names := map[string]string{}
+	for _, r := range root.everyRequest() {
+		if r.Expect.Snapshot == nil || !r.Expect.Snapshot.Enabled {
+			continue
+		}
+		path := r.Expect.Snapshot.path
+		if other, ok := names[path]; ok {
+			return fmt.Errorf("requests %q and %q use the same snapshot file %s, rename one of them", other, r.Name, path)
+		}
+		names[path] = r.Name
+	}
+	return nil
+}
+
+// page returns a copy of the snapshot for one page of a paginated request (see paginate),
+// stored in its own file, e.g. __snapshots__/test.yaml/list-users.page-2.json
+func (s Snapshot) page(n int) *Snapshot {
+	s.path = fmt.Sprintf("%s.page-%v.json", strings.TrimSuffix(s.path, ".json"), n)
+	return &s
+}
+
+// checkSnapshot compares a response to the stored snapshot. If there is no stored snapshot,
+// or update is true, the response is saved as the new snapshot instead.
+func checkSnapshot(s Snapshot, resp *http.Response, body []byte, update bool) error {
+	record, err := newSnapshotRecord(s, resp, body)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(s.path); update || os.IsNotExist(err) {
+		if err := writeSnapshot(s.path, record); err != nil {
+			return err
+		}
+		log.Printf("  ✓  snapshot written to %s", s.path)
+		return nil
+	}
+
+	file, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("could not read snapshot: %v", err)
+	}
+	var stored interface{}
+	if err := json.Unmarshal(file, &stored); err != nil {
+		return fmt.Errorf("could not decode snapshot %s: %v", s.path, err)
+	}
+
+	received, err := normalizeJSON(record)
+	if err != nil {
+		return err
+	}
+
+	diffs := compareBodies(stored, received, BodyExpectation{})
+	if len(diffs) > 0 {
+		return fmt.Errorf("response does not match snapshot %s (%v differences, use --update-snapshots to update):\n%s", s.path, len(diffs), formatBodyDiffs(diffs))
+	}
+	log.Println("  ✓  response matches snapshot")
+	return nil
+}
+
+// newSnapshotRecord builds a normalized and redacted snapshot from a response.
+// JSON bodies are stored as JSON, other bodies are stored as text.
+func newSnapshotRecord(s Snapshot, resp *http.Response, body []byte) (snapshotRecord, error) {
+	record := snapshotRecord{Status: resp.StatusCode}
+
+	if len(s.Headers) > 0 {
+		record.Headers = make(map[string]string)
+		for _, h := range s.Headers {
+			record.Headers[http.CanonicalHeaderKey(h)] = redactVolatile(resp.Header.Get(h))
+		}
+	}
+
+	var content interface{} = string(body)
+	if isJSON(resp.Header) {
+		if err := json.Unmarshal(body, &content); err != nil {
+			return record, fmt.Errorf("could not decode response body for snapshot: %v", err)
+		}
+	}
+
+	redacted := make([][]string, 0, len(s.Redact))
+	for _, selector := range s.Redact {
+		redacted = append(redacted, selectorSegments(selector))
+	}
+	record.Body = redactSnapshotValue([]string{}, content, &bodyComparer{ignore: redacted})
+
+	return record, nil
+}
+
+// redactSnapshotValue walks a response body, replacing values at the paths
+// that should be redacted and any volatile values like UUIDs and dates.
+func redactSnapshotValue(path []string, value interface{}, redacted *bodyComparer) interface{} {
+	if redacted.ignored(path) {
+		return "[redacted]"
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			out[k] = redactSnapshotValue(appendPath(path, k), item, redacted)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = redactSnapshotValue(appendPath(path, index(i)), item, redacted)
+		}
+		return out
+	case string:
+		return redactVolatile(v)
+	default:
+		return v
+	}
+}
+
+// redactVolatile replaces secrets, UUIDs and dates in a string with placeholders.
+func redactVolatile(s string) string {
+	s = secrets.redact(s)
+	for _, p := range volatilePatterns {
+		s = p.pattern.ReplaceAllString(s, p.replacement)
+	}
+	return s
+}
+
+func writeSnapshot(path string, record snapshotRecord) error {
+	out, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode snapshot: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("could not create snapshot directory: %v", err)
+	}
+	if err := ioutil.WriteFile(path, append(out, '\n'), 0644); err != nil {
+		return fmt.Errorf("could not write snapshot: %v", err)
+	}
+	return nil
+}
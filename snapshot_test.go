@@ -0,0 +1,106 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apitest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := Snapshot{Enabled: true, Headers: []string{"content-type"}, Redact: []string{"token"}}
+	s.path = snapshotPath(filepath.Join(dir, "test.yaml"), "Get a todo!")
+
+	if s.path != filepath.Join(dir, "__snapshots__", "test.yaml", "get-a-todo.json") {
+		t.Errorf("unexpected snapshot path %s", s.path)
+	}
+
+	resp := &http.Response{StatusCode: 200, Header: http.Header{}}
+	resp.Header.Set("Content-Type", "application/json")
+
+	// the first run stores the snapshot
+	body := []byte(`{"id":"0b5c6a5e-6b0e-4d4e-9f39-1e0b7f0f6c3a","title":"foo","token":"abc","created":"2019-04-01T10:00:00Z"}`)
+	if err := checkSnapshot(s, resp, body, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// volatile and redacted values may change without failing the comparison
+	body = []byte(`{"id":"6f1e7c2a-0d3b-4a8e-b0c1-2f3e4d5c6b7a","title":"foo","token":"def","created":"2019-04-02T11:30:00Z"}`)
+	if err := checkSnapshot(s, resp, body, false); err != nil {
+		t.Error(err)
+	}
+
+	body = []byte(`{"id":"6f1e7c2a-0d3b-4a8e-b0c1-2f3e4d5c6b7a","title":"bar","token":"def","created":"2019-04-02T11:30:00Z"}`)
+	if err := checkSnapshot(s, resp, body, false); err == nil {
+		t.Error("expected a changed title not to match the snapshot")
+	}
+
+	// update mode rewrites the snapshot
+	if err := checkSnapshot(s, resp, body, true); err != nil {
+		t.Error(err)
+	}
+	if err := checkSnapshot(s, resp, body, false); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSnapshotPathCollision(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apitest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cases := []struct {
+		spec string
+		ok   bool
+	}{
+		// requests in groups are named with the group's name, so they have their own files
+		{`
+requests:
+  - name: get-todo
+    url: http://localhost/todos/1
+    expect:
+      snapshot: true
+groups:
+  - name: Todos
+    requests:
+      - name: get-todo
+        url: http://localhost/todos/1
+        expect:
+          snapshot: true
+`, true},
+		// the names only differ by case and punctuation
+		{`
+requests:
+  - name: Get todo!
+    url: http://localhost/todos/1
+    expect:
+      snapshot: true
+  - name: get-todo
+    url: http://localhost/todos/2
+    expect:
+      snapshot: true
+`, false},
+	}
+
+	filename := filepath.Join(dir, "test.yaml")
+	for _, c := range cases {
+		ioutil.WriteFile(filename, []byte(c.spec), 0600)
+		_, err := readTestDefinition(filename)
+		if c.ok && err != nil {
+			t.Errorf("%s: %v", c.spec, err)
+		}
+		if !c.ok && (err == nil || !strings.Contains(err.Error(), "same snapshot file")) {
+			t.Errorf("%s: expected a snapshot file error, received %v", c.spec, err)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// StatusExpectation is the expected response status. It can be a single code (`status: 200`),
+// a class of codes (`status: 2xx`), a list of either (`status: [200, 204]`), or a block
+// of assertion rules (`status: {ge: 200, lt: 400}`). If no status is given, any 2xx
+// status is accepted.
+type StatusExpectation struct {
+	Codes   []int
+	Classes []int // e.g. 2 for 2xx
+	Rules   map[string]interface{}
+}
+
+// UnmarshalYAML reads a status code, class, list or block of assertion rules
+func (s *StatusExpectation) UnmarshalYAML(value *yaml.Node) error {
+	switch value.Kind {
+	case yaml.MappingNode:
+		return value.Decode(&s.Rules)
+	case yaml.SequenceNode:
+		for _, item := range value.Content {
+			if err := s.add(item.Value); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return s.add(value.Value)
+	}
+}
+
+// add adds a status code (e.g. "200") or class (e.g. "2xx")
+func (s *StatusExpectation) add(status string) error {
+	status = strings.ToLower(strings.TrimSpace(status))
+	if len(status) == 3 && strings.HasSuffix(status, "xx") && status[0] >= '1' && status[0] <= '5' {
+		s.Classes = append(s.Classes, int(status[0]-'0'))
+		return nil
+	}
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		return fmt.Errorf("invalid status %s. Use a status code (200), class (2xx), list ([200, 204]) or assertion rules", status)
+	}
+	s.Codes = append(s.Codes, code)
+	return nil
+}
+
+// check returns an error if the status code does not match the expected status.
+func (s StatusExpectation) check(code int) error {
+	if s.Rules != nil {
+		if err := checkAssertions(code, s.Rules); err != nil {
+			return fmt.Errorf("status %v", err)
+		}
+		return nil
+	}
+
+	classes := s.Classes
+	if len(s.Codes) == 0 && len(classes) == 0 {
+		classes = []int{2}
+	}
+
+	for _, c := range s.Codes {
+		if code == c {
+			return nil
+		}
+	}
+	for _, c := range classes {
+		if code/100 == c {
+			return nil
+		}
+	}
+	return fmt.Errorf("expected: %v received: %v", s, code)
+}
+
+// String returns the expected status in the same format it's written in a test spec.
+func (s StatusExpectation) String() string {
+	if s.Rules != nil {
+		return fmt.Sprintf("%v", s.Rules)
+	}
+	if len(s.Codes) == 0 && len(s.Classes) == 0 {
+		return "2xx"
+	}
+	statuses := []string{}
+	for _, c := range s.Codes {
+		statuses = append(statuses, strconv.Itoa(c))
+	}
+	for _, c := range s.Classes {
+		statuses = append(statuses, fmt.Sprintf("%vxx", c))
+	}
+	return strings.Join(statuses, " or ")
+}
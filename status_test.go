@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestStatusExpectation(t *testing.T) {
+	type testCase struct {
+		Status      string
+		Code        int
+		ExpectMatch bool
+	}
+
+	cases := []testCase{
+		testCase{Status: `200`, Code: 200, ExpectMatch: true},
+		testCase{Status: `200`, Code: 201, ExpectMatch: false},
+		testCase{Status: `2xx`, Code: 204, ExpectMatch: true},
+		testCase{Status: `4XX`, Code: 204, ExpectMatch: false},
+		testCase{Status: `[200, 204]`, Code: 204, ExpectMatch: true},
+		testCase{Status: `[200, 4xx]`, Code: 404, ExpectMatch: true},
+		testCase{Status: `[200, 204]`, Code: 201, ExpectMatch: false},
+		testCase{Status: `{ge: 200, lt: 400}`, Code: 302, ExpectMatch: true},
+		testCase{Status: `{ge: 200, lt: 400}`, Code: 404, ExpectMatch: false},
+	}
+
+	for _, c := range cases {
+		var s StatusExpectation
+		if err := yaml.Unmarshal([]byte(c.Status), &s); err != nil {
+			t.Fatal(err)
+		}
+		err := s.check(c.Code)
+		if (err == nil) != c.ExpectMatch {
+			t.Errorf("failed: expected status %s matching %v to have been %v; %v", c.Status, c.Code, c.ExpectMatch, err)
+		}
+	}
+
+	// any 2xx status is accepted when no status was given
+	var e Expect
+	if err := yaml.Unmarshal([]byte(`values: {id: 1}`), &e); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Status.check(201); err != nil {
+		t.Error(err)
+	}
+	if err := e.Status.check(500); err == nil {
+		t.Error("expected status 500 not to match the default status")
+	}
+
+	var s StatusExpectation
+	if err := yaml.Unmarshal([]byte(`ok`), &s); err == nil {
+		t.Error("expected an invalid status to return an error")
+	}
+}
@@ -0,0 +1,523 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Templates are strings containing {{ expression }} tags. An expression is a variable,
+// a literal or a function call, and can be piped into other functions:
+//
+//	{{ host }}                           a variable
+//	{{ user.id }}  {{ items[0].name }}   nested values in maps and lists
+//	{{ my-var }}  {{ .token }}           names may contain dashes, and a leading period is optional
+//	{{ randomInt 1 10 }}                 a function call with arguments
+//	{{ name | upper | default "none" }}  pipes: the value is passed as the last argument
+//	{{ date "2006" (dateAdd "24h" now) }} parentheses group a nested expression
+//
+// A literal "{{" can be written as \{{ (or {{ "{{" }}).
+
+// templatePart is either plain text or an expression from a template tag.
+type templatePart struct {
+	text string
+	expr pipeline
+}
+
+// pipeline is a list of commands separated by pipes. The result of each
+// command is passed as the last argument to the next one.
+type pipeline []command
+
+// command is a function call (a name followed by arguments) or a single operand.
+type command []operand
+
+// operand is a literal value, a variable/function name or a nested pipeline.
+type operand struct {
+	literal  interface{}
+	isLit    bool
+	name     string
+	path     []string
+	nested   pipeline
+	isNested bool
+}
+
+// parseTemplate splits a template into text and expressions.
+func parseTemplate(text string) ([]templatePart, error) {
+	parts := []templatePart{}
+	var buf strings.Builder
+
+	for len(text) > 0 {
+		if strings.HasPrefix(text, `\{{`) {
+			buf.WriteString("{{")
+			text = text[3:]
+			continue
+		}
+		if !strings.HasPrefix(text, "{{") {
+			buf.WriteByte(text[0])
+			text = text[1:]
+			continue
+		}
+
+		end := findTagEnd(text)
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed template tag in: %s", text)
+		}
+		expr, err := parseExpression(text[2:end])
+		if err != nil {
+			return nil, fmt.Errorf("error in template tag %s: %v", text[:end+2], err)
+		}
+		if buf.Len() > 0 {
+			parts = append(parts, templatePart{text: buf.String()})
+			buf.Reset()
+		}
+		parts = append(parts, templatePart{expr: expr})
+		text = text[end+2:]
+	}
+
+	if buf.Len() > 0 {
+		parts = append(parts, templatePart{text: buf.String()})
+	}
+	return parts, nil
+}
+
+// findTagEnd returns the index of the "}}" closing a template tag, ignoring
+// braces inside quoted strings.
+func findTagEnd(text string) int {
+	var quote byte
+	for i := 2; i < len(text)-1; i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '}' && text[i+1] == '}':
+			return i
+		}
+	}
+	return -1
+}
+
+// renderTemplate renders a template string, replacing each tag with the value of its expression.
+// Missing variables are rendered as an empty string.
+func renderTemplate(name string, text string, vars map[string]interface{}) (string, error) {
+	parts, err := parseTemplate(text)
+	if err != nil {
+		return text, fmt.Errorf("%s: %v", name, err)
+	}
+
+	var buf strings.Builder
+	for _, p := range parts {
+		if p.expr == nil {
+			buf.WriteString(p.text)
+			continue
+		}
+		value, err := p.expr.eval(vars)
+		if err != nil {
+			return text, fmt.Errorf("%s: %v", name, err)
+		}
+		buf.WriteString(templateString(value))
+	}
+	return buf.String(), nil
+}
+
+// renderValue renders a template like renderTemplate, except that a template consisting
+// of a single tag (e.g. "{{count}}") returns the expression's value with its type intact.
+func renderValue(name string, text string, vars map[string]interface{}) (interface{}, error) {
+	parts, err := parseTemplate(text)
+	if err != nil {
+		return text, fmt.Errorf("%s: %v", name, err)
+	}
+	if len(parts) == 1 && parts[0].expr != nil {
+		value, err := parts[0].expr.eval(vars)
+		if err != nil {
+			return text, fmt.Errorf("%s: %v", name, err)
+		}
+		return value, nil
+	}
+	return renderTemplate(name, text, vars)
+}
+
+// templateString formats a value for output in a template. Numbers are never written
+// in exponent form, times are written in RFC3339 form, and maps and lists are written as JSON.
+func templateString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case map[string]interface{}, []interface{}:
+		b, err := json.Marshal(v)
+		if err == nil {
+			return string(b)
+		}
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// parseExpression parses the contents of a template tag.
+func parseExpression(expr string) (pipeline, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	p, rest, err := parsePipeline(tokens)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("unexpected %s", rest[0].text)
+	}
+	return p, nil
+}
+
+type token struct {
+	kind string // "string", "number", "name", "|", "(" or ")"
+	text string
+}
+
+func tokenize(expr string) ([]token, error) {
+	tokens := []token{}
+	i := 0
+	for i < len(expr) {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '|' || c == '(' || c == ')':
+			tokens = append(tokens, token{kind: string(c), text: string(c)})
+			i++
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(expr) && expr[j] != c {
+				if expr[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(expr) {
+				return nil, errors.New("unterminated string")
+			}
+			s := expr[i+1 : j]
+			if c == '"' {
+				unquoted, err := strconv.Unquote(expr[i : j+1])
+				if err != nil {
+					return nil, fmt.Errorf("invalid string %s", expr[i:j+1])
+				}
+				s = unquoted
+			} else {
+				s = strings.Replace(s, `\'`, `'`, -1)
+			}
+			tokens = append(tokens, token{kind: "string", text: s})
+			i = j + 1
+		default:
+			j := i
+			for j < len(expr) && !strings.ContainsRune(" \t\n\r|()\"'", rune(expr[j])) {
+				j++
+			}
+			word := expr[i:j]
+			kind := "name"
+			if _, err := strconv.ParseFloat(word, 64); err == nil {
+				kind = "number"
+			}
+			tokens = append(tokens, token{kind: kind, text: word})
+			i = j
+		}
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("empty expression")
+	}
+	return tokens, nil
+}
+
+// parsePipeline parses commands separated by pipes, stopping at a closing parenthesis.
+func parsePipeline(tokens []token) (pipeline, []token, error) {
+	p := pipeline{}
+	cmd := command{}
+
+	for len(tokens) > 0 {
+		t := tokens[0]
+		switch t.kind {
+		case ")":
+			if len(cmd) == 0 {
+				return nil, nil, errors.New("missing expression")
+			}
+			return append(p, cmd), tokens, nil
+		case "|":
+			if len(cmd) == 0 {
+				return nil, nil, errors.New("missing expression before |")
+			}
+			p = append(p, cmd)
+			cmd = command{}
+			tokens = tokens[1:]
+		case "(":
+			nested, rest, err := parsePipeline(tokens[1:])
+			if err != nil {
+				return nil, nil, err
+			}
+			if len(rest) == 0 || rest[0].kind != ")" {
+				return nil, nil, errors.New("missing )")
+			}
+			cmd = append(cmd, operand{nested: nested, isNested: true})
+			tokens = rest[1:]
+		case "string":
+			cmd = append(cmd, operand{literal: t.text, isLit: true})
+			tokens = tokens[1:]
+		case "number":
+			n, _ := strconv.ParseFloat(t.text, 64)
+			var value interface{} = n
+			if i, err := strconv.Atoi(t.text); err == nil {
+				value = i
+			}
+			cmd = append(cmd, operand{literal: value, isLit: true})
+			tokens = tokens[1:]
+		default:
+			op, err := parseName(t.text)
+			if err != nil {
+				return nil, nil, err
+			}
+			cmd = append(cmd, op)
+			tokens = tokens[1:]
+		}
+	}
+
+	if len(cmd) == 0 {
+		return nil, nil, errors.New("missing expression after |")
+	}
+	return append(p, cmd), tokens, nil
+}
+
+// parseName parses a variable or function name. Variable paths are split into
+// segments, e.g. `.user.items[0]` becomes ["user", "items", "0"].
+func parseName(name string) (operand, error) {
+	switch name {
+	case "true":
+		return operand{literal: true, isLit: true}, nil
+	case "false":
+		return operand{literal: false, isLit: true}, nil
+	case "null", "nil":
+		return operand{literal: nil, isLit: true}, nil
+	}
+
+	path := []string{}
+	for _, segment := range strings.Split(strings.TrimPrefix(name, "."), ".") {
+		for strings.Contains(segment, "[") {
+			start := strings.Index(segment, "[")
+			end := strings.Index(segment, "]")
+			if end < start {
+				return operand{}, fmt.Errorf("invalid name %s", name)
+			}
+			if start > 0 {
+				path = append(path, segment[:start])
+			}
+			path = append(path, segment[start+1:end])
+			segment = segment[end+1:]
+		}
+		if segment != "" {
+			path = append(path, segment)
+		}
+	}
+	if len(path) == 0 {
+		return operand{}, fmt.Errorf("invalid name %s", name)
+	}
+	return operand{name: strings.TrimPrefix(name, "."), path: path}, nil
+}
+
+func (p pipeline) eval(vars map[string]interface{}) (interface{}, error) {
+	var value interface{}
+	for i, cmd := range p {
+		var err error
+		value, err = cmd.eval(vars, value, i > 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return value, nil
+}
+
+// eval evaluates a command. If the command is part of a pipe (piped is true), the
+// value from the previous command is passed as the last argument.
+func (c command) eval(vars map[string]interface{}, pipedValue interface{}, piped bool) (interface{}, error) {
+	first := c[0]
+
+	// the first word is a function call if it's a function name, unless it is
+	// also the name of a variable and is used on its own.
+	fn, isFunc := templateFuncs[first.name]
+	if first.name != "" && isFunc {
+		if _, isVar := lookupVar(vars, first.path); !isVar || len(c) > 1 || piped {
+			args := []interface{}{}
+			for _, op := range c[1:] {
+				value, err := op.eval(vars)
+				if err != nil {
+					return nil, err
+				}
+				args = append(args, value)
+			}
+			if piped {
+				args = append(args, pipedValue)
+			}
+			return callFunc(first.name, fn, args)
+		}
+	}
+
+	if len(c) > 1 {
+		return nil, fmt.Errorf("%s is not a function", c[0].describe())
+	}
+	if piped {
+		return nil, fmt.Errorf("can't pipe a value into %s: it is not a function", first.describe())
+	}
+	return first.eval(vars)
+}
+
+func (o operand) eval(vars map[string]interface{}) (interface{}, error) {
+	switch {
+	case o.isLit:
+		return o.literal, nil
+	case o.isNested:
+		return o.nested.eval(vars)
+	}
+	if value, ok := lookupVar(vars, o.path); ok {
+		return value, nil
+	}
+	// a function name used as an argument is called without arguments, e.g. `date "2006" now`
+	if fn, ok := templateFuncs[o.name]; ok {
+		return callFunc(o.name, fn, []interface{}{})
+	}
+	return nil, nil
+}
+
+func (o operand) describe() string {
+	if o.isLit {
+		return fmt.Sprintf("%v", o.literal)
+	}
+	if o.isNested {
+		return "(...)"
+	}
+	return o.name
+}
+
+// lookupVar finds a value in the vars map. Names containing periods are looked up as a
+// whole first, so a variable named "api.host" is found before the key "host" in a map named "api".
+func lookupVar(vars map[string]interface{}, path []string) (interface{}, bool) {
+	for i := len(path); i > 0; i-- {
+		value, ok := vars[strings.Join(path[:i], ".")]
+		if !ok {
+			continue
+		}
+		for _, segment := range path[i:] {
+			switch v := value.(type) {
+			case map[string]interface{}:
+				value, ok = v[segment]
+			case []interface{}:
+				n, err := strconv.Atoi(segment)
+				ok = err == nil && n >= 0 && n < len(v)
+				if ok {
+					value = v[n]
+				}
+			default:
+				ok = false
+			}
+			if !ok {
+				return nil, false
+			}
+		}
+		return value, true
+	}
+	return nil, false
+}
+
+// callFunc calls a function from the template function library, converting
+// arguments to the types the function expects.
+func callFunc(name string, fn interface{}, args []interface{}) (interface{}, error) {
+	f := reflect.ValueOf(fn)
+	t := f.Type()
+
+	if t.IsVariadic() {
+		if len(args) < t.NumIn()-1 {
+			return nil, fmt.Errorf("%s: expected at least %v arguments, received %v", name, t.NumIn()-1, len(args))
+		}
+	} else if len(args) != t.NumIn() {
+		return nil, fmt.Errorf("%s: expected %v arguments, received %v", name, t.NumIn(), len(args))
+	}
+
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		var paramType reflect.Type
+		if t.IsVariadic() && i >= t.NumIn()-1 {
+			paramType = t.In(t.NumIn() - 1).Elem()
+		} else {
+			paramType = t.In(i)
+		}
+		v, err := convertArg(arg, paramType)
+		if err != nil {
+			return nil, fmt.Errorf("%s: argument %v: %v", name, i+1, err)
+		}
+		in[i] = v
+	}
+
+	out := f.Call(in)
+	if len(out) == 2 && !out[1].IsNil() {
+		return nil, fmt.Errorf("%s: %v", name, out[1].Interface())
+	}
+	return out[0].Interface(), nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// convertArg converts a template value to the type of a function parameter.
+func convertArg(arg interface{}, t reflect.Type) (reflect.Value, error) {
+	if t.Kind() == reflect.Interface {
+		if arg == nil {
+			return reflect.Zero(t), nil
+		}
+		return reflect.ValueOf(arg), nil
+	}
+
+	if arg != nil && reflect.TypeOf(arg) == t {
+		return reflect.ValueOf(arg), nil
+	}
+
+	switch {
+	case t == timeType:
+		parsed, err := time.Parse(time.RFC3339, templateString(arg))
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("expected a time, received %v", arg)
+		}
+		return reflect.ValueOf(parsed), nil
+	case t.Kind() == reflect.String:
+		return reflect.ValueOf(templateString(arg)).Convert(t), nil
+	case t.Kind() == reflect.Int:
+		n, err := strconv.ParseFloat(templateString(arg), 64)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("expected a number, received %v", arg)
+		}
+		return reflect.ValueOf(int(n)), nil
+	case t.Kind() == reflect.Float64:
+		n, err := strconv.ParseFloat(templateString(arg), 64)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("expected a number, received %v", arg)
+		}
+		return reflect.ValueOf(n), nil
+	case t.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(templateString(arg))
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("expected true or false, received %v", arg)
+		}
+		return reflect.ValueOf(b), nil
+	}
+	return reflect.Value{}, fmt.Errorf("unsupported argument type %s", t)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	vars := map[string]interface{}{
+		"host":     "localhost:8000",
+		"my-var":   "dashes",
+		"api.host": "dotted",
+		"id":       float64(1234567),
+		"user": map[string]interface{}{
+			"id":    1,
+			"name":  "alice",
+			"roles": []interface{}{"admin", "user"},
+		},
+		"now": "a variable named now",
+	}
+
+	type testCase struct {
+		Template string
+		Expected string
+	}
+
+	cases := []testCase{
+		testCase{Template: `{{host}}/api`, Expected: "localhost:8000/api"},
+		testCase{Template: `{{ .host }}/api`, Expected: "localhost:8000/api"},
+		testCase{Template: `{{ my-var }}`, Expected: "dashes"},
+		testCase{Template: `{{ api.host }}`, Expected: "dotted"},
+		testCase{Template: `/users/{{ user.id }}`, Expected: "/users/1"},
+		testCase{Template: `{{ user.roles[1] }} {{ user.roles.0 }}`, Expected: "user admin"},
+		testCase{Template: `{{ user.name | upper }}`, Expected: "ALICE"},
+		testCase{Template: `{{ missing | default "none" | upper }}`, Expected: "NONE"},
+		testCase{Template: `{{ default 'x' user.name }}`, Expected: "alice"},
+		testCase{Template: `{{ user.roles | len }}`, Expected: "2"},
+		testCase{Template: `{{ id }}`, Expected: "1234567"},
+		testCase{Template: `{{ user.roles }}`, Expected: `["admin","user"]`},
+		testCase{Template: `{{ missing }}`, Expected: ""},
+		testCase{Template: `{{ now }}`, Expected: "a variable named now"},
+		testCase{Template: `{{ date "2006" (dateAdd "24h" "2019-12-31T12:00:00Z") }}`, Expected: "2020"},
+		testCase{Template: `{{ dateAdd "24h" "2019-12-31T12:00:00Z" }}`, Expected: "2020-01-01T12:00:00Z"},
+		testCase{Template: `{"json": "braces"}`, Expected: `{"json": "braces"}`},
+		testCase{Template: `\{{ host }}`, Expected: "{{ host }}"},
+		testCase{Template: `{{ "{{" }}host}}`, Expected: "{{host}}"},
+		testCase{Template: `{{ "a \"quoted\" }} string" }}`, Expected: `a "quoted" }} string`},
+	}
+
+	for _, c := range cases {
+		out, err := renderTemplate("test", c.Template, vars)
+		if err != nil {
+			t.Errorf("%s: %v", c.Template, err)
+			continue
+		}
+		if out != c.Expected {
+			t.Errorf("%s: expected '%v', received '%v'", c.Template, c.Expected, out)
+		}
+	}
+}
+
+func TestRenderNow(t *testing.T) {
+	out, err := renderTemplate("test", `{{ now }}`, map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out, "m=+") {
+		t.Errorf("expected now to be formatted without a monotonic clock reading, received '%s'", out)
+	}
+	if _, err := time.Parse(time.RFC3339, out); err != nil {
+		t.Errorf("expected now to be formatted as RFC3339: %v", err)
+	}
+}
+
+func TestRenderTemplateErrors(t *testing.T) {
+	vars := map[string]interface{}{"host": "localhost"}
+
+	templates := []string{
+		`{{ host`,
+		`{{ }}`,
+		`{{ host | }}`,
+		`{{ host "extra" }}`,
+		`{{ "x" | host }}`,
+		`{{ randomInt 1 }}`,
+		`{{ randomInt "a" 2 }}`,
+		`{{ upper ("x" }}`,
+	}
+
+	for _, tmpl := range templates {
+		if _, err := renderTemplate("test", tmpl, vars); err == nil {
+			t.Errorf("%s: expected an error", tmpl)
+		}
+	}
+}
+
+func TestRenderValue(t *testing.T) {
+	vars := map[string]interface{}{
+		"count": 5,
+		"user":  map[string]interface{}{"id": 1},
+	}
+
+	type testCase struct {
+		Template string
+		Expected interface{}
+	}
+
+	cases := []testCase{
+		testCase{Template: `{{count}}`, Expected: 5},
+		testCase{Template: `{{ user.id }}`, Expected: 1},
+		testCase{Template: `{{ user }}`, Expected: map[string]interface{}{"id": 1}},
+		testCase{Template: `{{ len "abc" }}`, Expected: 3},
+		testCase{Template: `{{ true }}`, Expected: true},
+		testCase{Template: `count: {{count}}`, Expected: "count: 5"},
+		testCase{Template: `no tags`, Expected: "no tags"},
+	}
+
+	for _, c := range cases {
+		out, err := renderValue("test", c.Template, vars)
+		if err != nil {
+			t.Errorf("%s: %v", c.Template, err)
+			continue
+		}
+		if !reflect.DeepEqual(out, c.Expected) {
+			t.Errorf("%s: expected '%v', received '%v'", c.Template, c.Expected, out)
+		}
+	}
+}
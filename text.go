@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TextExpectation holds rules that are checked against the raw response body.
+// They can be used with any type of response (plain text, HTML, XML, JSON).
+// Contains and Regex accept a single string or a list of strings, and
+// Length accepts a number or a block of assertion rules (e.g. `gt: 0`).
+type TextExpectation struct {
+	Contains stringList  `yaml:"contains"`
+	Regex    stringList  `yaml:"regex"`
+	Equals   *string     `yaml:"equals"`
+	Length   interface{} `yaml:"length"`
+}
+
+// stringList is a list of strings that can also be written as a single string in yaml.
+type stringList []string
+
+// UnmarshalYAML accepts either a single string or a list of strings.
+func (l *stringList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*l = stringList{value.Value}
+		return nil
+	}
+	var list []string
+	if err := value.Decode(&list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// checkText checks a response body against text rules, returning an error
+// for every rule that failed.
+func checkText(body string, rules TextExpectation) []error {
+	errs := []error{}
+
+	for _, s := range rules.Contains {
+		if !strings.Contains(body, s) {
+			errs = append(errs, fmt.Errorf("expected body to contain: %s", s))
+		}
+	}
+
+	for _, pattern := range rules.Regex {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid regex %s: %v", pattern, err))
+			continue
+		}
+		if !re.MatchString(body) {
+			errs = append(errs, fmt.Errorf("expected body to match regex: %s", pattern))
+		}
+	}
+
+	if rules.Equals != nil && body != *rules.Equals {
+		errs = append(errs, fmt.Errorf("expected body: %s received: %s", *rules.Equals, body))
+	}
+
+	switch length := rules.Length.(type) {
+	case nil:
+	case map[string]interface{}:
+		if err := checkAssertions(len(body), length); err != nil {
+			errs = append(errs, fmt.Errorf("body length: %v", err))
+		}
+	default:
+		if !equals(len(body), length) {
+			errs = append(errs, fmt.Errorf("expected body length: %v received: %v", length, len(body)))
+		}
+	}
+
+	return errs
+}
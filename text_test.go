@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestCheckText(t *testing.T) {
+	type testCase struct {
+		Rules  string
+		Body   string
+		Errors int
+	}
+
+	cases := []testCase{
+		testCase{Rules: `contains: world`, Body: "hello world", Errors: 0},
+		testCase{Rules: `contains: [hello, moon]`, Body: "hello world", Errors: 1},
+		testCase{Rules: `regex: "^hel+o"`, Body: "hello world", Errors: 0},
+		testCase{Rules: `regex: "^world"`, Body: "hello world", Errors: 1},
+		testCase{Rules: `equals: hello world`, Body: "hello world", Errors: 0},
+		testCase{Rules: `equals: hello`, Body: "hello world", Errors: 1},
+		testCase{Rules: `length: 11`, Body: "hello world", Errors: 0},
+		testCase{Rules: `length: {gt: 20}`, Body: "hello world", Errors: 1},
+		testCase{Rules: `{contains: hello, length: {lt: 5}, regex: "moon"}`, Body: "hello world", Errors: 2},
+	}
+
+	for _, c := range cases {
+		var rules TextExpectation
+		if err := yaml.Unmarshal([]byte(c.Rules), &rules); err != nil {
+			t.Fatal(err)
+		}
+		errs := checkText(c.Body, rules)
+		if len(errs) != c.Errors {
+			t.Errorf("failed: %s; expected %v errors, received %v: %v", c.Rules, c.Errors, len(errs), errs)
+		}
+	}
+}
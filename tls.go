@@ -0,0 +1,176 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// TLSConfig holds TLS settings for requests. File paths in a test spec are relative
+// to the spec file.
+type TLSConfig struct {
+	// CA is a PEM file of CA certificates to trust, in addition to the system's certificates
+	CA string `yaml:"ca"`
+	// Cert and Key are PEM files with a client certificate and its private key, for mutual TLS
+	Cert string `yaml:"cert"`
+	Key  string `yaml:"key"`
+	// ServerName overrides the host name used to verify the server's certificate
+	ServerName string `yaml:"serverName"`
+	// MinVersion is the minimum TLS version: 1.0, 1.1, 1.2 or 1.3
+	MinVersion string `yaml:"minVersion"`
+	// InsecureSkipVerify turns off verification of the server's certificate. It's a pointer
+	// so that a profile or group can turn verification back on with `insecureSkipVerify: false`.
+	InsecureSkipVerify *bool `yaml:"insecureSkipVerify"`
+}
+
+// transportKey identifies a TLS config by value, for caching transports.
+type transportKey struct {
+	config   TLSConfig
+	insecure bool
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// transportCache holds an http.Transport for each TLS config, so that certificates
+// are only loaded once and connections are reused between requests.
+type transportCache struct {
+	mu         sync.Mutex
+	transports map[transportKey]*http.Transport
+}
+
+var tlsTransports = &transportCache{transports: make(map[transportKey]*http.Transport)}
+
+// merge overrides settings with those set in other
+func (t *TLSConfig) merge(other *TLSConfig) {
+	if other == nil {
+		return
+	}
+	if other.CA != "" {
+		t.CA = other.CA
+	}
+	if other.Cert != "" {
+		t.Cert = other.Cert
+	}
+	if other.Key != "" {
+		t.Key = other.Key
+	}
+	if other.ServerName != "" {
+		t.ServerName = other.ServerName
+	}
+	if other.MinVersion != "" {
+		t.MinVersion = other.MinVersion
+	}
+	if other.InsecureSkipVerify != nil {
+		insecure := *other.InsecureSkipVerify
+		t.InsecureSkipVerify = &insecure
+	}
+}
+
+// insecure returns true if verification of the server's certificate is turned off
+func (t TLSConfig) insecure() bool {
+	return t.InsecureSkipVerify != nil && *t.InsecureSkipVerify
+}
+
+func (t TLSConfig) key() transportKey {
+	config := t
+	config.InsecureSkipVerify = nil
+	return transportKey{config: config, insecure: t.insecure()}
+}
+
+// otherHosts returns the settings for requests to hosts other than the one being tested, like
+// OAuth2 token endpoints. The server name and client certificate are only meant for the
+// host being tested, so they are left out.
+func (t *TLSConfig) otherHosts() *TLSConfig {
+	if t == nil {
+		return nil
+	}
+	return &TLSConfig{CA: t.CA, MinVersion: t.MinVersion, InsecureSkipVerify: t.InsecureSkipVerify}
+}
+
+// resolveFiles makes file paths relative to the test spec file.
+func (t *TLSConfig) resolveFiles(specFile string) {
+	if t == nil {
+		return
+	}
+	for _, f := range []*string{&t.CA, &t.Cert, &t.Key} {
+		if *f != "" && !filepath.IsAbs(*f) {
+			*f = filepath.Join(filepath.Dir(specFile), *f)
+		}
+	}
+}
+
+// transport returns an http.Transport using the TLS settings. A nil config uses the default transport.
+func (t *TLSConfig) transport() (http.RoundTripper, error) {
+	if t == nil || t.key() == (transportKey{}) {
+		return http.DefaultTransport, nil
+	}
+
+	tlsTransports.mu.Lock()
+	defer tlsTransports.mu.Unlock()
+	if transport, ok := tlsTransports.transports[t.key()]; ok {
+		return transport, nil
+	}
+
+	config, err := t.config()
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	tlsTransports.transports[t.key()] = transport
+	return transport, nil
+}
+
+// config builds a tls.Config, loading the CA bundle and client certificate.
+func (t TLSConfig) config() (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.insecure(),
+	}
+
+	if t.MinVersion != "" {
+		version, ok := tlsVersions[strings.TrimPrefix(strings.ToUpper(t.MinVersion), "TLS")]
+		if !ok {
+			return nil, fmt.Errorf("invalid TLS minVersion %s (use 1.0, 1.1, 1.2 or 1.3)", t.MinVersion)
+		}
+		config.MinVersion = version
+	}
+
+	if t.CA != "" {
+		pem, err := ioutil.ReadFile(t.CA)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA bundle: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", t.CA)
+		}
+		config.RootCAs = pool
+	}
+
+	if t.Cert != "" || t.Key != "" {
+		if t.Cert == "" || t.Key == "" {
+			return nil, errors.New("a TLS client certificate needs both cert and key")
+		}
+		cert, err := tls.LoadX509KeyPair(t.Cert, t.Key)
+		if err != nil {
+			return nil, fmt.Errorf("could not load TLS client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+// writeClientCert writes a self signed client certificate and key to dir
+func writeClientCert(t *testing.T, dir string) (*x509.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "apitest client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem")
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return cert, certFile, keyFile
+}
+
+func TestTLSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apitest-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	clientCert, certFile, keyFile := writeClientCert(t, dir)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(basicRequestHandler))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+
+	caFile := filepath.Join(dir, "ca.pem")
+	ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600)
+
+	cases := []struct {
+		name string
+		tls  *TLSConfig
+		ok   bool
+	}{
+		{"default settings", nil, false},
+		{"CA without client certificate", &TLSConfig{CA: caFile}, false},
+		{"CA and client certificate", &TLSConfig{CA: caFile, Cert: certFile, Key: keyFile, MinVersion: "1.2"}, true},
+		{"insecure with client certificate", &TLSConfig{InsecureSkipVerify: boolPtr(true), Cert: certFile, Key: keyFile}, true},
+		{"wrong server name", &TLSConfig{CA: caFile, Cert: certFile, Key: keyFile, ServerName: "wrong.test"}, false},
+	}
+
+	for _, c := range cases {
+		env := Environment{Vars: map[string]interface{}{"host": server.URL}, TLS: c.tls}
+		r := Request{Name: c.name, URL: "{{host}}/todos/1", Method: "get", Expect: Expect{Status: StatusExpectation{Codes: []int{200}}}}
+		_, _, err := request(r, 1, env, RunOptions{})
+		if c.ok && err != nil {
+			t.Errorf("%s: %v", c.name, err)
+		}
+		if !c.ok && err == nil {
+			t.Errorf("%s: expected the request to fail", c.name)
+		}
+	}
+
+	invalid := []TLSConfig{
+		{MinVersion: "1.4"},
+		{Cert: certFile},
+		{CA: filepath.Join(dir, "missing.pem")},
+		{CA: keyFile},
+	}
+	for _, c := range invalid {
+		if _, err := c.transport(); err == nil {
+			t.Errorf("%+v: expected an error", c)
+		}
+	}
+}
+
+func TestTLSMerge(t *testing.T) {
+	set := TestSet{
+		Environment: Environment{TLS: &TLSConfig{CA: "ca.pem", MinVersion: "1.2", InsecureSkipVerify: boolPtr(true)}},
+		Environments: map[string]Environment{
+			"dev":  {TLS: &TLSConfig{MinVersion: "1.3"}},
+			"prod": {TLS: &TLSConfig{InsecureSkipVerify: boolPtr(false)}},
+		},
+	}
+
+	cases := []struct {
+		profile  string
+		expected TLSConfig
+		insecure bool
+	}{
+		{"dev", TLSConfig{CA: "ca.pem", MinVersion: "1.3"}, true},
+		// a profile can turn verification back on
+		{"prod", TLSConfig{CA: "ca.pem", MinVersion: "1.2"}, false},
+	}
+	for _, c := range cases {
+		env, err := buildEnvironment(set, c.profile, nil, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if env.TLS.key() != (transportKey{config: c.expected, insecure: c.insecure}) {
+			t.Errorf("%s: expected '%+v' (insecure: %v), received '%+v' (insecure: %v)", c.profile, c.expected, c.insecure, *env.TLS, env.TLS.insecure())
+		}
+	}
+
+	// command line settings override the spec
+	opts := RunOptions{TLS: TLSConfig{CA: "cli.pem", InsecureSkipVerify: boolPtr(false)}}
+	merged := opts.tlsConfig(set.Environment.TLS)
+	if merged.CA != "cli.pem" || merged.MinVersion != "1.2" || merged.insecure() {
+		t.Errorf("unexpected TLS settings '%+v'", *merged)
+	}
+}
+
+func TestGroupTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(basicRequestHandler))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "apitest-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600)
+
+	group := Group{
+		Name:        "Internal",
+		Environment: Environment{TLS: &TLSConfig{CA: filepath.Join(dir, "missing.pem"), MinVersion: "1.2"}},
+		Requests: []Request{
+			{Name: "Internal > todo", URL: "{{host}}/todos/1", Method: "get", Expect: Expect{Status: StatusExpectation{Codes: []int{200}}}},
+		},
+	}
+	set := TestSet{Environment: Environment{Vars: map[string]interface{}{"host": server.URL}}, Groups: []Group{group}}
+
+	// the group's CA bundle doesn't exist, so the request only passes if --cacert overrides it
+	summary, _ := runTestSet(set, RunOptions{TLS: TLSConfig{CA: caFile}})
+	if summary.Total != 1 || summary.Failed != 0 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+	summary, _ = runTestSet(set, RunOptions{})
+	if summary.Failed != 1 {
+		t.Errorf("expected the group's TLS settings to be used, received %+v", summary)
+	}
+}
+
+func TestTLSOtherHosts(t *testing.T) {
+	config := &TLSConfig{CA: "ca.pem", Cert: "client.pem", Key: "client-key.pem", ServerName: "api.internal", MinVersion: "1.2"}
+	expected := TLSConfig{CA: "ca.pem", MinVersion: "1.2"}
+	if other := config.otherHosts(); *other != expected {
+		t.Errorf("Expected '%+v', received '%+v'", expected, *other)
+	}
+
+	var none *TLSConfig
+	if none.otherHosts() != nil {
+		t.Error("expected no TLS settings")
+	}
+}
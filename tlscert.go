@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// TLSExpectation holds rules checked against the server's certificate chain and
+// the TLS connection. DaysUntilExpiry and Version accept a value or a block of assertion
+// rules (e.g. `gt: 14`).
+type TLSExpectation struct {
+	// DaysUntilExpiry is the number of days until the first certificate in the chain expires
+	DaysUntilExpiry interface{} `yaml:"daysUntilExpiry"`
+	// Subject and Issuer match the server certificate's common name or full distinguished name
+	Subject string `yaml:"subject"`
+	Issuer  string `yaml:"issuer"`
+	// SAN lists names (DNS names or IP addresses) that must be in the server certificate
+	SAN stringList `yaml:"san"`
+	// Version is the TLS version of the connection, e.g. 1.3
+	Version interface{} `yaml:"version"`
+}
+
+var tlsVersionNames = map[uint16]string{
+	tls.VersionTLS10: "1.0",
+	tls.VersionTLS11: "1.1",
+	tls.VersionTLS12: "1.2",
+	tls.VersionTLS13: "1.3",
+}
+
+// certExpiry returns the expiry time of the certificate in the chain that expires first.
+func certExpiry(state *tls.ConnectionState) (time.Time, bool) {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return time.Time{}, false
+	}
+	expiry := state.PeerCertificates[0].NotAfter
+	for _, cert := range state.PeerCertificates[1:] {
+		if cert.NotAfter.Before(expiry) {
+			expiry = cert.NotAfter
+		}
+	}
+	return expiry, true
+}
+
+// checkTLS checks a TLS connection against rules, returning an error for every rule that failed.
+func checkTLS(state *tls.ConnectionState, rules TLSExpectation) []error {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return []error{errors.New("expected a TLS connection, but the response was not sent over TLS")}
+	}
+	errs := []error{}
+	cert := state.PeerCertificates[0]
+
+	if rules.DaysUntilExpiry != nil {
+		expiry, _ := certExpiry(state)
+		// days are rounded down to one decimal place, to keep messages readable
+		days := math.Floor(time.Until(expiry).Hours()/24*10) / 10
+		if err := checkValue(days, rules.DaysUntilExpiry); err != nil {
+			errs = append(errs, fmt.Errorf("certificate expiry (%s): days until expiry %v", expiry.Format(time.RFC3339), err))
+		}
+	}
+
+	if rules.Subject != "" && !nameMatches(cert.Subject.CommonName, cert.Subject.String(), rules.Subject) {
+		errs = append(errs, fmt.Errorf("expected certificate subject: %s received: %s", rules.Subject, cert.Subject))
+	}
+	if rules.Issuer != "" && !nameMatches(cert.Issuer.CommonName, cert.Issuer.String(), rules.Issuer) {
+		errs = append(errs, fmt.Errorf("expected certificate issuer: %s received: %s", rules.Issuer, cert.Issuer))
+	}
+
+	for _, name := range rules.SAN {
+		if !hasSAN(cert, name) {
+			errs = append(errs, fmt.Errorf("expected certificate to have subject alternative name: %s received: %v %v", name, cert.DNSNames, cert.IPAddresses))
+		}
+	}
+
+	if rules.Version != nil {
+		version, ok := tlsVersionNames[state.Version]
+		if !ok {
+			version = fmt.Sprintf("0x%04x", state.Version)
+		}
+		if err := checkValue(version, tlsVersionRule(rules.Version)); err != nil {
+			errs = append(errs, fmt.Errorf("TLS version %v", err))
+		}
+	}
+	return errs
+}
+
+// checkValue compares a value with an expected value or a block of assertion rules
+func checkValue(value interface{}, expected interface{}) error {
+	if rules, ok := expected.(map[string]interface{}); ok {
+		return checkAssertions(value, rules)
+	}
+	if !equals(value, expected) {
+		return fmt.Errorf("expected: %v received: %v", expected, value)
+	}
+	return nil
+}
+
+// tlsVersionRule formats numbers in a version rule like TLS version names. yaml reads
+// `version: 1.0` as the number 1, which would otherwise not equal "1.0".
+func tlsVersionRule(rule interface{}) interface{} {
+	if rules, ok := rule.(map[string]interface{}); ok {
+		formatted := make(map[string]interface{}, len(rules))
+		for k, v := range rules {
+			formatted[k] = tlsVersionRule(v)
+		}
+		return formatted
+	}
+	if f, err := strconv.ParseFloat(fmt.Sprintf("%v", rule), 64); err == nil {
+		return strconv.FormatFloat(f, 'f', 1, 64)
+	}
+	return rule
+}
+
+func nameMatches(commonName string, dn string, expected string) bool {
+	return expected == commonName || expected == dn
+}
+
+// hasSAN returns true if a certificate has a DNS name or IP address SAN
+func hasSAN(cert *x509.Certificate, name string) bool {
+	for _, n := range cert.DNSNames {
+		if n == name {
+			return true
+		}
+	}
+	for _, ip := range cert.IPAddresses {
+		if ip.String() == name {
+			return true
+		}
+	}
+	return false
+}
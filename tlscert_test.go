@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"gopkg.in/yaml.v3"
+)
+
+func TestCheckTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(basicRequestHandler))
+	defer server.Close()
+
+	env := Environment{
+		Vars: map[string]interface{}{"host": server.URL},
+		TLS:  &TLSConfig{InsecureSkipVerify: boolPtr(true)},
+	}
+
+	cases := []struct {
+		name  string
+		rules TLSExpectation
+		ok    bool
+	}{
+		{"expiry", TLSExpectation{DaysUntilExpiry: map[string]interface{}{"gt": 14}}, true},
+		{"expiry too soon", TLSExpectation{DaysUntilExpiry: map[string]interface{}{"lt": 14}}, false},
+		{"subject and issuer", TLSExpectation{Subject: "O=Acme Co", Issuer: "O=Acme Co"}, true},
+		{"wrong subject", TLSExpectation{Subject: "api.example.com"}, false},
+		{"san", TLSExpectation{SAN: stringList{"example.com", "127.0.0.1"}}, true},
+		{"missing san", TLSExpectation{SAN: stringList{"other.test"}}, false},
+		{"version", TLSExpectation{Version: map[string]interface{}{"ge": 1.2}}, true},
+		{"exact version", TLSExpectation{Version: "1.0"}, false},
+		{"matching version", TLSExpectation{Version: 1.3}, true},
+		{"matching version rule", TLSExpectation{Version: map[string]interface{}{"equals": "1.3"}}, true},
+	}
+
+	for _, c := range cases {
+		rules := c.rules
+		r := Request{Name: c.name, URL: "{{host}}/todos/1", Method: "get", Expect: Expect{Status: StatusExpectation{Codes: []int{200}}, TLS: &rules}}
+		_, _, err := request(r, 1, env, RunOptions{Monitor: true})
+		if c.ok && err != nil {
+			t.Errorf("%s: %v", c.name, err)
+		}
+		if !c.ok && err == nil {
+			t.Errorf("%s: expected the request to fail", c.name)
+		}
+	}
+
+	// certificate expiry is recorded in monitor mode
+	m := &dto.Metric{}
+	certExpirySeconds.WithLabelValues("127.0.0.1").Write(m)
+	if m.GetGauge().GetValue() < 14*24*60*60 {
+		t.Errorf("unexpected cert expiry %v", m.GetGauge().GetValue())
+	}
+
+	// responses that were not sent over TLS fail TLS checks
+	if errs := checkTLS(nil, TLSExpectation{}); len(errs) != 1 {
+		t.Errorf("expected an error for a response without TLS, received %v", errs)
+	}
+}
+
+func TestTLSVersionRule(t *testing.T) {
+	// yaml reads `version: 1.0` as a number
+	rule := TLSExpectation{}
+	if err := yaml.Unmarshal([]byte("version: 1.0"), &rule); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkValue("1.0", tlsVersionRule(rule.Version)); err != nil {
+		t.Error(err)
+	}
+	if err := checkValue("1.2", tlsVersionRule(map[string]interface{}{"equals": 1.2, "ge": 1})); err != nil {
+		t.Error(err)
+	}
+}
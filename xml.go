@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// xmlNode is an element in a parsed XML document. Names are stored without
+// their namespace prefix, so `soap:Envelope` is matched by the selector `Envelope`.
+type xmlNode struct {
+	Name     string
+	Attrs    map[string]string
+	Children []*xmlNode
+	Text     string
+}
+
+// parseXML reads an XML document into a tree of nodes. The returned node is a
+// document root whose only child is the document's root element.
+func parseXML(body []byte) (*xmlNode, error) {
+	root := &xmlNode{}
+	stack := []*xmlNode{root}
+
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder.Strict = false
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not decode XML response body: %v", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{Name: t.Name.Local, Attrs: make(map[string]string)}
+			for _, a := range t.Attr {
+				node.Attrs[a.Name.Local] = a.Value
+			}
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, node)
+			stack = append(stack, node)
+		case xml.EndElement:
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			stack[len(stack)-1].Text += string(t)
+		}
+	}
+
+	if len(root.Children) == 0 {
+		return nil, errors.New("could not decode XML response body: no root element")
+	}
+	return root, nil
+}
+
+// value returns the text content of a node and all its descendants.
+func (n *xmlNode) value() string {
+	var buf strings.Builder
+	n.writeText(&buf)
+	return strings.TrimSpace(buf.String())
+}
+
+func (n *xmlNode) writeText(buf *strings.Builder) {
+	buf.WriteString(n.Text)
+	for _, c := range n.Children {
+		c.writeText(buf)
+	}
+}
+
+// descendants returns the node and all nodes below it, in document order.
+func (n *xmlNode) descendants() []*xmlNode {
+	nodes := []*xmlNode{n}
+	for _, c := range n.Children {
+		nodes = append(nodes, c.descendants()...)
+	}
+	return nodes
+}
+
+// checkXMLResponse finds the values selected by an XPath expression and compares the first
+// one with the expected value. The expected value may be a block of assertion rules, like
+// those used in expect.values.
+func checkXMLResponse(doc *xmlNode, selector string, expectedValue interface{}) error {
+	values, err := xpath(doc, selector)
+	if err != nil {
+		return err
+	}
+	if len(values) == 0 {
+		return fmt.Errorf("no value found for XPath selector %s", selector)
+	}
+
+	switch expectedValue.(type) {
+	case map[string]interface{}:
+		return checkAssertions(values[0], expectedValue.(map[string]interface{}))
+	default:
+		if !equals(values[0], expectedValue) {
+			return fmt.Errorf("expected: %v received: %v", expectedValue, values[0])
+		}
+		return nil
+	}
+}
+
+// xpath evaluates a subset of XPath against a document and returns the string value
+// of every matching node. Supported syntax:
+//
+//	/a/b        child elements, starting from the document root
+//	//b         elements at any depth
+//	*           any element
+//	b[2]        the second b element (1-based), or b[last()]
+//	b[@id]      b elements with an id attribute, or b[@id='3'] with a matching value
+//	b[c='x']    b elements with a child element c with the text x
+//	@id         attribute values (last step only)
+//	text()      the text directly inside an element (last step only)
+//	count(...)  the number of nodes matched by the expression
+func xpath(doc *xmlNode, selector string) ([]string, error) {
+	selector = strings.TrimSpace(selector)
+
+	if strings.HasPrefix(selector, "count(") && strings.HasSuffix(selector, ")") {
+		values, err := xpath(doc, selector[len("count("):len(selector)-1])
+		if err != nil {
+			return nil, err
+		}
+		return []string{strconv.Itoa(len(values))}, nil
+	}
+
+	steps, err := splitXPath(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := []*xmlNode{doc}
+	for i, step := range steps {
+		last := i == len(steps)-1
+
+		if last && strings.HasPrefix(step.name, "@") {
+			values := []string{}
+			for _, n := range expandAxis(nodes, step.descendant) {
+				if v, ok := n.Attrs[step.name[1:]]; ok {
+					values = append(values, v)
+				}
+			}
+			return values, nil
+		}
+
+		if last && step.name == "text()" {
+			values := []string{}
+			for _, n := range expandAxis(nodes, step.descendant) {
+				values = append(values, strings.TrimSpace(n.Text))
+			}
+			return values, nil
+		}
+
+		next := []*xmlNode{}
+		for _, n := range expandAxis(nodes, step.descendant) {
+			matched := []*xmlNode{}
+			for _, c := range n.Children {
+				if step.name == "*" || c.Name == step.name {
+					matched = append(matched, c)
+				}
+			}
+			for _, p := range step.predicates {
+				matched, err = filterXPath(matched, p)
+				if err != nil {
+					return nil, err
+				}
+			}
+			next = append(next, matched...)
+		}
+		nodes = next
+	}
+
+	values := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		values = append(values, n.value())
+	}
+	return values, nil
+}
+
+// xpathStep is a single step in an XPath expression, e.g. `//item[2]`
+type xpathStep struct {
+	name       string
+	descendant bool
+	predicates []string
+}
+
+// splitXPath splits a selector into steps. Slashes inside predicates and quotes are ignored.
+func splitXPath(selector string) ([]xpathStep, error) {
+	if !strings.HasPrefix(selector, "/") {
+		// relative selectors are evaluated from the document root
+		selector = "/" + selector
+	}
+
+	steps := []xpathStep{}
+	depth := 0
+	var quote rune
+	start := 0
+	descendant := false
+
+	addStep := func(end int) error {
+		raw := selector[start:end]
+		if raw == "" {
+			// an empty step between two slashes means "//"
+			descendant = true
+			return nil
+		}
+		step, err := parseXPathStep(raw)
+		if err != nil {
+			return err
+		}
+		step.descendant = descendant
+		descendant = false
+		steps = append(steps, step)
+		return nil
+	}
+
+	for i, c := range selector {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case c == '/' && depth == 0:
+			if i > 0 {
+				if err := addStep(i); err != nil {
+					return nil, err
+				}
+			}
+			start = i + 1
+		}
+	}
+	if err := addStep(len(selector)); err != nil {
+		return nil, err
+	}
+	if quote != 0 || depth != 0 || len(steps) == 0 {
+		return nil, fmt.Errorf("invalid XPath selector %s", selector)
+	}
+	return steps, nil
+}
+
+func parseXPathStep(raw string) (xpathStep, error) {
+	step := xpathStep{}
+	i := strings.Index(raw, "[")
+	if i < 0 {
+		step.name = raw
+		return step, nil
+	}
+	step.name = raw[:i]
+	rest := raw[i:]
+	for rest != "" {
+		if rest[0] != '[' {
+			return step, fmt.Errorf("invalid XPath step %s", raw)
+		}
+		end := strings.Index(rest, "]")
+		if end < 0 {
+			return step, fmt.Errorf("invalid XPath step %s", raw)
+		}
+		step.predicates = append(step.predicates, strings.TrimSpace(rest[1:end]))
+		rest = rest[end+1:]
+	}
+	return step, nil
+}
+
+// expandAxis returns the nodes whose children should be searched for the next step.
+func expandAxis(nodes []*xmlNode, descendant bool) []*xmlNode {
+	if !descendant {
+		return nodes
+	}
+	expanded := []*xmlNode{}
+	for _, n := range nodes {
+		expanded = append(expanded, n.descendants()...)
+	}
+	return expanded
+}
+
+// filterXPath filters a list of nodes with a predicate such as `2`, `last()`, `@id='3'` or `name='x'`
+func filterXPath(nodes []*xmlNode, predicate string) ([]*xmlNode, error) {
+	if predicate == "last()" {
+		if len(nodes) == 0 {
+			return nodes, nil
+		}
+		return nodes[len(nodes)-1:], nil
+	}
+
+	if position, err := strconv.Atoi(predicate); err == nil {
+		if position < 1 || position > len(nodes) {
+			return []*xmlNode{}, nil
+		}
+		return nodes[position-1 : position], nil
+	}
+
+	name, value, hasValue := predicate, "", false
+	if i := strings.Index(predicate, "="); i >= 0 {
+		name = strings.TrimSpace(predicate[:i])
+		value = strings.Trim(strings.TrimSpace(predicate[i+1:]), `'"`)
+		hasValue = true
+	}
+	if name == "" {
+		return nil, fmt.Errorf("invalid XPath predicate [%s]", predicate)
+	}
+
+	filtered := []*xmlNode{}
+	for _, n := range nodes {
+		if strings.HasPrefix(name, "@") {
+			if v, ok := n.Attrs[name[1:]]; ok && (!hasValue || v == value) {
+				filtered = append(filtered, n)
+			}
+			continue
+		}
+		for _, c := range n.Children {
+			if c.Name == name && (!hasValue || c.value() == value) {
+				filtered = append(filtered, n)
+				break
+			}
+		}
+	}
+	return filtered, nil
+}
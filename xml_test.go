@@ -0,0 +1,52 @@
+package main
+
+import "testing"
+
+func TestXPath(t *testing.T) {
+	body := []byte(`<?xml version="1.0"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap:Body>
+    <GetOrderResponse>
+      <status>ok</status>
+      <item id="1" type="book"><name>Go</name><price>10</price></item>
+      <item id="2" type="food"><name>Pizza</name><price>15</price></item>
+    </GetOrderResponse>
+  </soap:Body>
+</soap:Envelope>`)
+
+	doc, err := parseXML(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type testCase struct {
+		Selector    string
+		Expected    interface{}
+		ExpectEqual bool
+	}
+
+	cases := []testCase{
+		testCase{Selector: "/Envelope/Body/GetOrderResponse/status", Expected: "ok", ExpectEqual: true},
+		testCase{Selector: "Envelope/Body/GetOrderResponse/status/text()", Expected: "ok", ExpectEqual: true},
+		testCase{Selector: "//status", Expected: "failed", ExpectEqual: false},
+		testCase{Selector: "//item[2]/name", Expected: "Pizza", ExpectEqual: true},
+		testCase{Selector: "//item[last()]/@id", Expected: 2, ExpectEqual: true},
+		testCase{Selector: "//item[@type='book']/price", Expected: 10, ExpectEqual: true},
+		testCase{Selector: "//item[name='Pizza']/@type", Expected: "food", ExpectEqual: true},
+		testCase{Selector: "//item/price", Expected: map[string]interface{}{"lt": 11}, ExpectEqual: true},
+		testCase{Selector: "count(//item)", Expected: 2, ExpectEqual: true},
+		testCase{Selector: "//missing", Expected: "", ExpectEqual: false},
+		testCase{Selector: "//item[@id='1'", Expected: "", ExpectEqual: false},
+	}
+
+	for _, c := range cases {
+		err := checkXMLResponse(doc, c.Selector, c.Expected)
+		if (err == nil) != c.ExpectEqual {
+			t.Errorf("failed: expected %s == %v to have been %v; %v", c.Selector, c.Expected, c.ExpectEqual, err)
+		}
+	}
+
+	if _, err := parseXML([]byte(`not xml`)); err == nil {
+		t.Error("expected an error parsing a body that isn't XML")
+	}
+}